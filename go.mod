@@ -1,5 +1,5 @@
 module github.com/blugelabs/query_string
 
-go 1.14
+go 1.15
 
-require github.com/blugelabs/bluge v0.1.1
+require github.com/blugelabs/bluge v0.2.2
@@ -1,20 +1,23 @@
 %{
 package querystr
-
-import(
-    "github.com/blugelabs/bluge"
-)
 %}
 
 %union {
 s string
 n int
 f float64
-q bluge.Query
-pf *float64}
+b bool
+node Node
+nodes []Node
+rb rangeBound
+fn functionCall
+pf *float64
+p Prefix
+start int
+end int}
 
 %token tSTRING tPHRASE tPLUS tMINUS tCOLON tBOOST tNUMBER tSTRING tGREATER tLESS
-tEQUAL tTILDE
+tEQUAL tTILDE tLPAREN tRPAREN tAND tOR tNOT tLBRACKET tRBRACKET tLBRACE tRBRACE tTO tFUNCTION tZONE tDATE
 
 %type <s>                tSTRING
 %type <s>                tPHRASE
@@ -22,189 +25,335 @@ tEQUAL tTILDE
 %type <s>                posOrNegNumber
 %type <s>                tTILDE
 %type <s>                tBOOST
-%type <q>                searchBase
+%type <s>                tZONE
+%type <s>                tDATE
+%type <s>                fieldName
+%type <fn>               tFUNCTION
+%type <node>             searchBase
+%type <node>             searchValue
+%type <node>             fieldValue
+%type <nodes>            searchParts
+%type <node>             searchPart
+%type <node>             searchClause
+%type <node>             notExpr
+%type <nodes>            orExprs
+%type <nodes>            andExprs
+%type <rb>               rangeBound
+%type <b>                rangeStart
+%type <b>                rangeEnd
 %type <pf>                searchSuffix
-%type <n>                searchPrefix
+%type <p>                searchPrefix
 
 %%
 
 input:
 searchParts {
 	yylex.(*lexerWrapper).logDebugGrammarf("INPUT")
+	yylex.(*lexerWrapper).root = newGroup($1)
 };
 
 searchParts:
-searchPart searchParts {
+searchParts searchClause {
 	yylex.(*lexerWrapper).logDebugGrammarf("SEARCH PARTS")
+	$$ = append($1, $2)
 }
 |
-searchPart {
+searchClause {
 	yylex.(*lexerWrapper).logDebugGrammarf("SEARCH PART")
+	$$ = []Node{$1}
+}
+|
+searchParts error {
+	yylex.(*lexerWrapper).logDebugGrammarf("ERROR")
+	if yylex.(*lexerWrapper).recovered() {
+		// the token failed again after the error, skip it
+		yyrcvr.char = -1
+	}
+	// like yyerrok, the errors which follow are reported too
+	Errflag = 0
+	$$ = $1
+}
+|
+error {
+	yylex.(*lexerWrapper).logDebugGrammarf("ERROR")
+	if yylex.(*lexerWrapper).recovered() {
+		// the token failed again after the error, skip it
+		yyrcvr.char = -1
+	}
+	// like yyerrok, the errors which follow are reported too
+	Errflag = 0
+	$$ = nil
+};
+
+searchClause:
+orExprs {
+	$$ = newOr($1)
+};
+
+orExprs:
+orExprs tOR andExprs {
+	yylex.(*lexerWrapper).logDebugGrammarf("OR")
+	$$ = append($1, newAnd($3))
+}
+|
+andExprs {
+	$$ = []Node{newAnd($1)}
+};
+
+andExprs:
+andExprs tAND notExpr {
+	yylex.(*lexerWrapper).logDebugGrammarf("AND")
+	$$ = append($1, $3)
+}
+|
+notExpr {
+	$$ = []Node{$1}
+};
+
+notExpr:
+tNOT notExpr {
+	yylex.(*lexerWrapper).logDebugGrammarf("NOT")
+	n := &Not{Clause: $2}
+	n.Start = $<start>1
+	_, n.End = $2.Span()
+	$$ = n
+}
+|
+searchPart {
+	$$ = $1
 };
 
 searchPart:
 searchPrefix searchBase searchSuffix {
-    q := $2
-    if $3 != nil {
-        var err error
-        q, err = queryStringSetBoost($2, *$3)
-        if err != nil {
-          yylex.(*lexerWrapper).lex.Error(err.Error())
-        }
-    }
-	switch($1) {
-		case queryShould:
-			yylex.(*lexerWrapper).query.AddShould(q)
-		case queryMust:
-			yylex.(*lexerWrapper).query.AddMust(q)
-		case queryMustNot:
-			yylex.(*lexerWrapper).query.AddMustNot(q)
+	n := $2.base()
+	n.Prefix = $1
+	if $<start>1 >= 0 {
+		n.Start = $<start>1
+	}
+	if $3 != nil {
+		n.Boost = $3
+		n.End = $<end>3
 	}
+	$$ = $2
 };
 
 
 searchPrefix:
 /* empty */ {
-	$$ = queryShould
+	$$ = NoPrefix
+	$<start>$ = -1
 }
 |
 tPLUS {
 	yylex.(*lexerWrapper).logDebugGrammarf("PLUS")
-	$$ = queryMust
+	$$ = MustPrefix
 }
 |
 tMINUS {
 	yylex.(*lexerWrapper).logDebugGrammarf("MINUS")
-	$$ = queryMustNot
+	$$ = MustNotPrefix
 };
 
 searchBase:
-tSTRING {
-    yylex.(*lexerWrapper).logDebugGrammarf("STRING - %s", $1)
-	$$ = queryStringStringToken("", $1)
+searchValue {
+	$$ = $1
 }
 |
-tSTRING tTILDE {
-    yylex.(*lexerWrapper).logDebugGrammarf("FUZZY STRING - %s %s", $1, $2)
-	q, err := queryStringStringTokenFuzzy("", $1, $2)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+fieldName fieldValue {
+	yylex.(*lexerWrapper).popField()
+	n := $2.base()
+	n.Field = $1
+	n.Start = $<start>1
+	$$ = $2
+};
+
+fieldName:
+tSTRING tCOLON {
+	yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s", $1)
+	yylex.(*lexerWrapper).pushField($1)
+	$$ = $1
+};
+
+fieldValue:
+searchValue {
+	$$ = $1
 }
 |
-tSTRING tCOLON tSTRING tTILDE {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s FUZZY STRING - %s %s", $1, $3, $4)
-    q, err := queryStringStringTokenFuzzy($1, $3, $4)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+tMINUS tNUMBER {
+	yylex.(*lexerWrapper).logDebugGrammarf("NUMBER - -%s", $2)
+	n, err := queryStringNumberToken("-" + $2)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>2, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>2)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>2)
+	}
+};
+
+searchValue:
+tFUNCTION {
+	yylex.(*lexerWrapper).logDebugGrammarf("FUNCTION - %s %q", $1.name, $1.args)
+	n, err := queryStringFunction($1)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>1, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>1)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>1)
+	}
 }
 |
-tNUMBER {
+groupStart searchParts tRPAREN {
+	yylex.(*lexerWrapper).logDebugGrammarf("GROUP")
+	yylex.(*lexerWrapper).endGroup()
+	$$ = withSpan(&Group{Clauses: $2}, $<start>1, $<end>3)
+}
+|
+tSTRING {
 	yylex.(*lexerWrapper).logDebugGrammarf("STRING - %s", $1)
-	q, err := queryStringNumberToken("", $1)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+	$$ = withSpan(queryStringStringToken($1), $<start>1, $<end>1)
+}
+|
+tSTRING tTILDE {
+	yylex.(*lexerWrapper).logDebugGrammarf("FUZZY STRING - %s %s", $1, $2)
+	n, err := queryStringStringTokenFuzzy($1, $2)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>2, $<end>2, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>2)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>2)
+	}
+}
+|
+tNUMBER {
+	yylex.(*lexerWrapper).logDebugGrammarf("NUMBER - %s", $1)
+	n, err := queryStringNumberToken($1)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>1, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>1)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>1)
+	}
 }
 |
 tPHRASE {
 	yylex.(*lexerWrapper).logDebugGrammarf("PHRASE - %s", $1)
-	$$ = queryStringPhraseToken("", $1)
+	$$ = withSpan(queryStringPhraseToken($1), $<start>1, $<end>1)
 }
 |
-tSTRING tCOLON tSTRING {
-	yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s STRING - %s", $1, $3)
-	$$ = queryStringStringToken($1, $3)
+tPHRASE tTILDE {
+	yylex.(*lexerWrapper).logDebugGrammarf("SLOPPY PHRASE - %s %s", $1, $2)
+	n, err := queryStringPhraseTokenSlop($1, $2)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>2, $<end>2, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>2)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>2)
+	}
 }
 |
-tSTRING tCOLON posOrNegNumber {
-	yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s STRING - %s", $1, $3)
-	q, err := queryStringNumberToken($1, $3)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+tGREATER rangeBound {
+	yylex.(*lexerWrapper).logDebugGrammarf("GREATER THAN %s", $2.value)
+	n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), $2, openRangeBound, false, true)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>2, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>2)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>2)
+	}
 }
 |
-tSTRING tCOLON tPHRASE {
-	yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s PHRASE - %s", $1, $3)
-	$$ = queryStringPhraseToken($1, $3)
+tGREATER tEQUAL rangeBound {
+	yylex.(*lexerWrapper).logDebugGrammarf("GREATER THAN OR EQUAL %s", $3.value)
+	n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), $3, openRangeBound, true, true)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>3, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>3)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>3)
+	}
 }
 |
-tSTRING tCOLON tGREATER posOrNegNumber {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN %s", $4)
-	q, err := queryStringNumericRangeGreaterThanOrEqual($1, $4, false)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+tLESS rangeBound {
+	yylex.(*lexerWrapper).logDebugGrammarf("LESS THAN %s", $2.value)
+	n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), openRangeBound, $2, true, false)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>2, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>2)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>2)
+	}
 }
 |
-tSTRING tCOLON tGREATER tEQUAL posOrNegNumber {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN OR EQUAL %s", $5)
-    q, err := queryStringNumericRangeGreaterThanOrEqual($1, $5, true)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-    $$ = q
+tLESS tEQUAL rangeBound {
+	yylex.(*lexerWrapper).logDebugGrammarf("LESS THAN OR EQUAL %s", $3.value)
+	n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), openRangeBound, $3, true, true)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>3, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>3)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>3)
+	}
+}
+|
+rangeStart rangeBound tTO rangeBound rangeEnd {
+	yylex.(*lexerWrapper).logDebugGrammarf("RANGE %s TO %s", $2.value, $4.value)
+	n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), $2, $4, $1, $5)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>5, err)
+		$$ = yylex.(*lexerWrapper).badNode($<start>1, $<end>5)
+	} else {
+		$$ = withSpan(n, $<start>1, $<end>5)
+	}
+};
+
+groupStart:
+tLPAREN {
+	yylex.(*lexerWrapper).startGroup()
+};
+
+rangeStart:
+tLBRACKET {
+	$$ = true
+}
+|
+tLBRACE {
+	$$ = false
+};
+
+rangeEnd:
+tRBRACKET {
+	$$ = true
 }
 |
-tSTRING tCOLON tLESS posOrNegNumber {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN %s", $4)
-    q, err := queryStringNumericRangeLessThanOrEqual($1, $4, false)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-    $$ = q
+tRBRACE {
+	$$ = false
+};
+
+rangeBound:
+posOrNegNumber {
+	$$ = rangeBound{value: $1, number: true}
 }
 |
-tSTRING tCOLON tLESS tEQUAL posOrNegNumber {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN OR EQUAL %s", $5)
-    q, err := queryStringNumericRangeLessThanOrEqual($1, $5, true)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-    $$ = q
+tPHRASE {
+	$$ = rangeBound{value: $1, phrase: true}
 }
 |
-tSTRING tCOLON tGREATER tPHRASE {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN DATE %s", $4)
-	q, err := queryStringDateRangeGreaterThanOrEqual(yylex, $1, $4, false)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+tPHRASE tZONE {
+	$$ = rangeBound{value: $1, phrase: true, zone: $2}
+	$<end>$ = $<end>2
 }
 |
-tSTRING tCOLON tGREATER tEQUAL tPHRASE {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN OR EQUAL DATE %s", $5)
-    q, err := queryStringDateRangeGreaterThanOrEqual(yylex, $1, $5, true)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+tDATE {
+	$$ = rangeBound{value: $1, isoDate: true}
 }
 |
-tSTRING tCOLON tLESS tPHRASE {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN DATE %s", $4)
-    q, err := queryStringDateRangeLessThanOrEqual(yylex, $1, $4, false)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+tDATE tZONE {
+	$$ = rangeBound{value: $1, isoDate: true, zone: $2}
+	$<end>$ = $<end>2
 }
 |
-tSTRING tCOLON tLESS tEQUAL tPHRASE {
-    yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN OR EQUAL DATE %s", $5)
-    q, err := queryStringDateRangeLessThanOrEqual(yylex, $1, $5, true)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    }
-	$$ = q
+tSTRING {
+	$$ = rangeBound{value: $1}
 };
 
 searchSuffix:
@@ -213,14 +362,14 @@ searchSuffix:
 }
 |
 tBOOST {
-    $$ = nil
-    yylex.(*lexerWrapper).logDebugGrammarf("BOOST %s", $1)
-    boost, err := queryStringParseBoost($1)
-    if err != nil {
-      yylex.(*lexerWrapper).lex.Error(err.Error())
-    } else {
-        $$ = &boost
-    }
+	$$ = nil
+	yylex.(*lexerWrapper).logDebugGrammarf("BOOST %s", $1)
+	boost, err := queryStringParseBoost($1)
+	if err != nil {
+		yylex.(*lexerWrapper).errorAt($<start>1, $<end>1, err)
+	} else {
+		$$ = &boost
+	}
 };
 
 posOrNegNumber:
@@ -230,4 +379,5 @@ tNUMBER {
 |
 tMINUS tNUMBER {
 	$$ = "-" + $2
+	$<end>$ = $<end>2
 };
@@ -5,18 +5,21 @@ import __yyfmt__ "fmt"
 
 //line query_string.y:2
 
-import (
-	"github.com/blugelabs/bluge"
-)
-
-//line query_string.y:9
+//line query_string.y:5
 type yySymType struct {
-	yys int
-	s   string
-	n   int
-	f   float64
-	q   bluge.Query
-	pf  *float64
+	yys   int
+	s     string
+	n     int
+	f     float64
+	b     bool
+	node  Node
+	nodes []Node
+	rb    rangeBound
+	fn    functionCall
+	pf    *float64
+	p     Prefix
+	start int
+	end   int
 }
 
 const tSTRING = 57346
@@ -30,6 +33,19 @@ const tGREATER = 57353
 const tLESS = 57354
 const tEQUAL = 57355
 const tTILDE = 57356
+const tLPAREN = 57357
+const tRPAREN = 57358
+const tAND = 57359
+const tOR = 57360
+const tNOT = 57361
+const tLBRACKET = 57362
+const tRBRACKET = 57363
+const tLBRACE = 57364
+const tRBRACE = 57365
+const tTO = 57366
+const tFUNCTION = 57367
+const tZONE = 57368
+const tDATE = 57369
 
 var yyToknames = [...]string{
 	"$end",
@@ -46,7 +62,21 @@ var yyToknames = [...]string{
 	"tLESS",
 	"tEQUAL",
 	"tTILDE",
+	"tLPAREN",
+	"tRPAREN",
+	"tAND",
+	"tOR",
+	"tNOT",
+	"tLBRACKET",
+	"tRBRACKET",
+	"tLBRACE",
+	"tRBRACE",
+	"tTO",
+	"tFUNCTION",
+	"tZONE",
+	"tDATE",
 }
+
 var yyStatenames = [...]string{}
 
 const yyEofCode = 1
@@ -54,74 +84,136 @@ const yyErrCode = 2
 const yyInitialStackSize = 16
 
 //line yacctab:1
-var yyExca = [...]int{
+var yyExca = [...]int8{
+	-1, 0,
+	4, 14,
+	5, 14,
+	10, 14,
+	11, 14,
+	12, 14,
+	15, 14,
+	20, 14,
+	22, 14,
+	25, 14,
+	-2, 0,
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 3,
-	1, 3,
-	-2, 5,
+	-1, 2,
+	1, 1,
+	4, 14,
+	5, 14,
+	10, 14,
+	11, 14,
+	12, 14,
+	15, 14,
+	20, 14,
+	22, 14,
+	25, 14,
+	-2, 0,
+	-1, 22,
+	4, 14,
+	5, 14,
+	10, 14,
+	11, 14,
+	12, 14,
+	15, 14,
+	20, 14,
+	22, 14,
+	25, 14,
+	-2, 0,
+	-1, 40,
+	4, 14,
+	5, 14,
+	10, 14,
+	11, 14,
+	12, 14,
+	15, 14,
+	20, 14,
+	22, 14,
+	25, 14,
+	-2, 0,
 }
 
 const yyPrivate = 57344
 
-const yyLast = 42
-
-var yyAct = [...]int{
-
-	17, 16, 18, 23, 22, 30, 3, 21, 19, 20,
-	29, 26, 22, 22, 1, 21, 21, 15, 28, 25,
-	24, 27, 34, 14, 22, 13, 31, 21, 32, 33,
-	22, 9, 11, 21, 5, 6, 2, 10, 4, 12,
-	7, 8,
+const yyLast = 96
+
+var yyAct = [...]int8{
+	44, 3, 39, 25, 13, 38, 59, 58, 24, 26,
+	27, 49, 47, 29, 51, 62, 16, 50, 30, 15,
+	31, 49, 47, 21, 51, 6, 2, 50, 52, 54,
+	53, 19, 23, 25, 48, 65, 42, 66, 24, 26,
+	27, 32, 13, 29, 48, 41, 57, 43, 30, 40,
+	31, 42, 37, 21, 61, 49, 47, 60, 51, 55,
+	22, 50, 14, 63, 45, 4, 11, 12, 14, 11,
+	12, 7, 11, 12, 11, 12, 56, 1, 48, 8,
+	17, 35, 8, 10, 34, 8, 64, 8, 33, 28,
+	5, 9, 36, 18, 20, 46,
 }
-var yyPact = [...]int{
 
-	28, -1000, -1000, 28, 27, -1000, -1000, -1000, 16, 9,
-	-1000, -1000, -1000, -1000, -1000, -3, -11, -1000, -1000, 6,
-	5, -1000, -5, -1000, -1000, 23, -1000, -1000, 17, -1000,
-	-1000, -1000, -1000, -1000, -1000,
+var yyPact = [...]int16{
+	63, -32768, 66, -32768, -32768, 1, -1, -32768, 68, -32768,
+	28, -32768, -32768, -32768, -32768, 68, 68, -32768, 72, -32768,
+	-2, -32768, 63, 37, -32768, 33, 51, 17, 7, -32768,
+	-32768, -32768, -1, -32768, -32768, -32768, -32768, -32768, 49, 22,
+	60, -32768, -32768, -32768, -32768, 7, -32768, -19, -20, -32768,
+	-32768, 47, -32768, 7, -9, -32768, -32768, -32768, -32768, -32768,
+	-32768, -32768, 7, 14, -32768, -32768, -32768,
 }
-var yyPgo = [...]int{
 
-	0, 0, 41, 39, 38, 14, 36, 6,
+var yyPgo = [...]int8{
+	0, 95, 94, 93, 31, 92, 26, 91, 1, 71,
+	90, 25, 0, 89, 86, 84, 83, 77, 60,
 }
-var yyR1 = [...]int{
 
-	0, 5, 6, 6, 7, 4, 4, 4, 2, 2,
-	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
-	2, 2, 2, 2, 3, 3, 1, 1,
+var yyR1 = [...]int8{
+	0, 17, 6, 6, 6, 6, 8, 10, 10, 11,
+	11, 9, 9, 7, 16, 16, 16, 3, 3, 2,
+	5, 5, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 18, 13, 13, 14, 14, 12,
+	12, 12, 12, 12, 12, 15, 15, 1, 1,
 }
-var yyR2 = [...]int{
 
-	0, 1, 2, 1, 3, 0, 1, 1, 1, 2,
-	4, 1, 1, 3, 3, 3, 4, 5, 4, 5,
-	4, 5, 4, 5, 0, 1, 1, 2,
+var yyR2 = [...]int8{
+	0, 1, 2, 1, 2, 1, 1, 3, 1, 3,
+	1, 2, 1, 3, 0, 1, 1, 1, 2, 2,
+	1, 2, 1, 3, 1, 2, 1, 1, 2, 2,
+	3, 2, 3, 5, 1, 1, 1, 1, 1, 1,
+	1, 2, 1, 2, 1, 0, 1, 1, 2,
 }
-var yyChk = [...]int{
 
-	-1000, -5, -6, -7, -4, 6, 7, -6, -2, 4,
-	10, 5, -3, 9, 14, 8, 4, -1, 5, 11,
-	12, 10, 7, 14, -1, 13, 5, -1, 13, 5,
-	10, -1, 5, -1, 5,
+var yyChk = [...]int16{
+	-32768, -17, -6, -8, 2, -10, -11, -9, 19, -7,
+	-16, 6, 7, -8, 2, 18, 17, -9, -3, -4,
+	-2, 25, -18, 4, 10, 5, 11, 12, -13, 15,
+	20, 22, -11, -9, -15, 9, -5, -4, 7, 4,
+	-6, 8, 14, 14, -12, 13, -1, 5, 27, 4,
+	10, 7, -12, 13, -12, 10, 16, -12, 26, 26,
+	10, -12, 24, -12, -14, 21, 23,
 }
-var yyDef = [...]int{
 
-	5, -2, 1, -2, 0, 6, 7, 2, 24, 8,
-	11, 12, 4, 25, 9, 0, 13, 14, 15, 0,
-	0, 26, 0, 10, 16, 0, 20, 18, 0, 22,
-	27, 17, 21, 19, 23,
+var yyDef = [...]int8{
+	-2, -2, -2, 3, 5, 6, 8, 10, 14, 12,
+	0, 15, 16, 2, 4, 14, 14, 11, 45, 17,
+	0, 22, -2, 24, 26, 27, 0, 0, 0, 34,
+	35, 36, 7, 9, 13, 46, 18, 20, 0, 24,
+	-2, 19, 25, 28, 29, 0, 39, 40, 42, 44,
+	47, 0, 31, 0, 0, 21, 23, 30, 41, 43,
+	48, 32, 0, 0, 33, 37, 38,
 }
-var yyTok1 = [...]int{
 
+var yyTok1 = [...]int8{
 	1,
 }
-var yyTok2 = [...]int{
 
+var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
-	12, 13, 14,
+	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
+	22, 23, 24, 25, 26, 27,
 }
-var yyTok3 = [...]int{
+
+var yyTok3 = [...]int8{
 	0,
 }
 
@@ -164,7 +256,7 @@ func yyNewParser() yyParser {
 	return &yyParserImpl{}
 }
 
-const yyFlag = -1000
+const yyFlag = -32768
 
 func yyTokname(c int) string {
 	if c >= 1 && c-1 < len(yyToknames) {
@@ -203,9 +295,9 @@ func yyErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := yyPact[state]
+	base := int(yyPact[state])
 	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
-		if n := base + tok; n >= 0 && n < yyLast && yyChk[yyAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -215,13 +307,13 @@ func yyErrorMessage(state, lookAhead int) string {
 
 	if yyDef[state] == -2 {
 		i := 0
-		for yyExca[i] != -1 || yyExca[i+1] != state {
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; yyExca[i] >= 0; i += 2 {
-			tok := yyExca[i]
+			tok := int(yyExca[i])
 			if tok < TOKSTART || yyExca[i+1] == 0 {
 				continue
 			}
@@ -252,30 +344,30 @@ func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = yyTok1[0]
+		token = int(yyTok1[0])
 		goto out
 	}
 	if char < len(yyTok1) {
-		token = yyTok1[char]
+		token = int(yyTok1[char])
 		goto out
 	}
 	if char >= yyPrivate {
 		if char < yyPrivate+len(yyTok2) {
-			token = yyTok2[char-yyPrivate]
+			token = int(yyTok2[char-yyPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(yyTok3); i += 2 {
-		token = yyTok3[i+0]
+		token = int(yyTok3[i+0])
 		if token == char {
-			token = yyTok3[i+1]
+			token = int(yyTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = yyTok2[1] /* unknown char */
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
@@ -330,7 +422,7 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	yyn = yyPact[yystate]
+	yyn = int(yyPact[yystate])
 	if yyn <= yyFlag {
 		goto yydefault /* simple state */
 	}
@@ -341,8 +433,8 @@ yynewstate:
 	if yyn < 0 || yyn >= yyLast {
 		goto yydefault
 	}
-	yyn = yyAct[yyn]
-	if yyChk[yyn] == yytoken { /* valid shift */
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
 		yyrcvr.char = -1
 		yytoken = -1
 		yyVAL = yyrcvr.lval
@@ -355,7 +447,7 @@ yynewstate:
 
 yydefault:
 	/* default state action */
-	yyn = yyDef[yystate]
+	yyn = int(yyDef[yystate])
 	if yyn == -2 {
 		if yyrcvr.char < 0 {
 			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
@@ -364,18 +456,18 @@ yydefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if yyExca[xi+0] == -1 && yyExca[xi+1] == yystate {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			yyn = yyExca[xi+0]
+			yyn = int(yyExca[xi+0])
 			if yyn < 0 || yyn == yytoken {
 				break
 			}
 		}
-		yyn = yyExca[xi+1]
+		yyn = int(yyExca[xi+1])
 		if yyn < 0 {
 			goto ret0
 		}
@@ -397,10 +489,10 @@ yydefault:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				yyn = yyPact[yyS[yyp].yys] + yyErrCode
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
 				if yyn >= 0 && yyn < yyLast {
-					yystate = yyAct[yyn] /* simulate a shift of "error" */
-					if yyChk[yystate] == yyErrCode {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -436,7 +528,7 @@ yydefault:
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= yyR2[yyn]
+	yyp -= int(yyR2[yyn])
 	// yyp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if yyp+1 >= len(yyS) {
@@ -447,16 +539,16 @@ yydefault:
 	yyVAL = yyS[yyp+1]
 
 	/* consult goto table to find next state */
-	yyn = yyR1[yyn]
-	yyg := yyPgo[yyn]
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
 	yyj := yyg + yyS[yyp].yys + 1
 
 	if yyj >= yyLast {
-		yystate = yyAct[yyg]
+		yystate = int(yyAct[yyg])
 	} else {
-		yystate = yyAct[yyj]
-		if yyChk[yystate] != -yyn {
-			yystate = yyAct[yyg]
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -464,253 +556,416 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:32
+//line query_string.y:50
 		{
 			yylex.(*lexerWrapper).logDebugGrammarf("INPUT")
+			yylex.(*lexerWrapper).root = newGroup(yyDollar[1].nodes)
 		}
 	case 2:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line query_string.y:37
+//line query_string.y:56
 		{
 			yylex.(*lexerWrapper).logDebugGrammarf("SEARCH PARTS")
+			yyVAL.nodes = append(yyDollar[1].nodes, yyDollar[2].node)
 		}
 	case 3:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:41
+//line query_string.y:61
 		{
 			yylex.(*lexerWrapper).logDebugGrammarf("SEARCH PART")
+			yyVAL.nodes = []Node{yyDollar[1].node}
 		}
 	case 4:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line query_string.y:46
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:66
 		{
-			q := yyDollar[2].q
-			if yyDollar[3].pf != nil {
-				var err error
-				q, err = queryStringSetBoost(yyDollar[2].q, *yyDollar[3].pf)
-				if err != nil {
-					yylex.(*lexerWrapper).lex.Error(err.Error())
-				}
-			}
-			switch yyDollar[1].n {
-			case queryShould:
-				yylex.(*lexerWrapper).query.AddShould(q)
-			case queryMust:
-				yylex.(*lexerWrapper).query.AddMust(q)
-			case queryMustNot:
-				yylex.(*lexerWrapper).query.AddMustNot(q)
+			yylex.(*lexerWrapper).logDebugGrammarf("ERROR")
+			if yylex.(*lexerWrapper).recovered() {
+				// the token failed again after the error, skip it
+				yyrcvr.char = -1
 			}
+			// like yyerrok, the errors which follow are reported too
+			Errflag = 0
+			yyVAL.nodes = yyDollar[1].nodes
 		}
 	case 5:
-		yyDollar = yyS[yypt-0 : yypt+1]
-//line query_string.y:67
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:77
 		{
-			yyVAL.n = queryShould
+			yylex.(*lexerWrapper).logDebugGrammarf("ERROR")
+			if yylex.(*lexerWrapper).recovered() {
+				// the token failed again after the error, skip it
+				yyrcvr.char = -1
+			}
+			// like yyerrok, the errors which follow are reported too
+			Errflag = 0
+			yyVAL.nodes = nil
 		}
 	case 6:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:71
+//line query_string.y:89
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("PLUS")
-			yyVAL.n = queryMust
+			yyVAL.node = newOr(yyDollar[1].nodes)
 		}
 	case 7:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:76
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line query_string.y:94
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("MINUS")
-			yyVAL.n = queryMustNot
+			yylex.(*lexerWrapper).logDebugGrammarf("OR")
+			yyVAL.nodes = append(yyDollar[1].nodes, newAnd(yyDollar[3].nodes))
 		}
 	case 8:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:82
+//line query_string.y:99
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("STRING - %s", yyDollar[1].s)
-			yyVAL.q = queryStringStringToken("", yyDollar[1].s)
+			yyVAL.nodes = []Node{newAnd(yyDollar[1].nodes)}
 		}
 	case 9:
-		yyDollar = yyS[yypt-2 : yypt+1]
-//line query_string.y:87
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line query_string.y:104
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FUZZY STRING - %s %s", yyDollar[1].s, yyDollar[2].s)
-			q, err := queryStringStringTokenFuzzy("", yyDollar[1].s, yyDollar[2].s)
-			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
-			}
-			yyVAL.q = q
+			yylex.(*lexerWrapper).logDebugGrammarf("AND")
+			yyVAL.nodes = append(yyDollar[1].nodes, yyDollar[3].node)
 		}
 	case 10:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line query_string.y:96
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:109
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s FUZZY STRING - %s %s", yyDollar[1].s, yyDollar[3].s, yyDollar[4].s)
-			q, err := queryStringStringTokenFuzzy(yyDollar[1].s, yyDollar[3].s, yyDollar[4].s)
-			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
-			}
-			yyVAL.q = q
+			yyVAL.nodes = []Node{yyDollar[1].node}
 		}
 	case 11:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:105
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:114
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("STRING - %s", yyDollar[1].s)
-			q, err := queryStringNumberToken("", yyDollar[1].s)
-			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
-			}
-			yyVAL.q = q
+			yylex.(*lexerWrapper).logDebugGrammarf("NOT")
+			n := &Not{Clause: yyDollar[2].node}
+			n.Start = yyDollar[1].start
+			_, n.End = yyDollar[2].node.Span()
+			yyVAL.node = n
 		}
 	case 12:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:114
+//line query_string.y:122
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("PHRASE - %s", yyDollar[1].s)
-			yyVAL.q = queryStringPhraseToken("", yyDollar[1].s)
+			yyVAL.node = yyDollar[1].node
 		}
 	case 13:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line query_string.y:119
+//line query_string.y:127
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s STRING - %s", yyDollar[1].s, yyDollar[3].s)
-			yyVAL.q = queryStringStringToken(yyDollar[1].s, yyDollar[3].s)
+			n := yyDollar[2].node.base()
+			n.Prefix = yyDollar[1].p
+			if yyDollar[1].start >= 0 {
+				n.Start = yyDollar[1].start
+			}
+			if yyDollar[3].pf != nil {
+				n.Boost = yyDollar[3].pf
+				n.End = yyDollar[3].end
+			}
+			yyVAL.node = yyDollar[2].node
 		}
 	case 14:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line query_string.y:124
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line query_string.y:142
+		{
+			yyVAL.p = NoPrefix
+			yyVAL.start = -1
+		}
+	case 15:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:147
+		{
+			yylex.(*lexerWrapper).logDebugGrammarf("PLUS")
+			yyVAL.p = MustPrefix
+		}
+	case 16:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:152
+		{
+			yylex.(*lexerWrapper).logDebugGrammarf("MINUS")
+			yyVAL.p = MustNotPrefix
+		}
+	case 17:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:158
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 18:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:162
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s STRING - %s", yyDollar[1].s, yyDollar[3].s)
-			q, err := queryStringNumberToken(yyDollar[1].s, yyDollar[3].s)
+			yylex.(*lexerWrapper).popField()
+			n := yyDollar[2].node.base()
+			n.Field = yyDollar[1].s
+			n.Start = yyDollar[1].start
+			yyVAL.node = yyDollar[2].node
+		}
+	case 19:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:171
+		{
+			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s", yyDollar[1].s)
+			yylex.(*lexerWrapper).pushField(yyDollar[1].s)
+			yyVAL.s = yyDollar[1].s
+		}
+	case 20:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:178
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 21:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:182
+		{
+			yylex.(*lexerWrapper).logDebugGrammarf("NUMBER - -%s", yyDollar[2].s)
+			n, err := queryStringNumberToken("-" + yyDollar[2].s)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[2].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[2].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[2].end)
 			}
-			yyVAL.q = q
 		}
-	case 15:
+	case 22:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:194
+		{
+			yylex.(*lexerWrapper).logDebugGrammarf("FUNCTION - %s %q", yyDollar[1].fn.name, yyDollar[1].fn.args)
+			n, err := queryStringFunction(yyDollar[1].fn)
+			if err != nil {
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[1].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[1].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[1].end)
+			}
+		}
+	case 23:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line query_string.y:133
+//line query_string.y:205
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - %s PHRASE - %s", yyDollar[1].s, yyDollar[3].s)
-			yyVAL.q = queryStringPhraseToken(yyDollar[1].s, yyDollar[3].s)
+			yylex.(*lexerWrapper).logDebugGrammarf("GROUP")
+			yylex.(*lexerWrapper).endGroup()
+			yyVAL.node = withSpan(&Group{Clauses: yyDollar[2].nodes}, yyDollar[1].start, yyDollar[3].end)
 		}
-	case 16:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line query_string.y:138
+	case 24:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:211
+		{
+			yylex.(*lexerWrapper).logDebugGrammarf("STRING - %s", yyDollar[1].s)
+			yyVAL.node = withSpan(queryStringStringToken(yyDollar[1].s), yyDollar[1].start, yyDollar[1].end)
+		}
+	case 25:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:216
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN %s", yyDollar[4].s)
-			q, err := queryStringNumericRangeGreaterThanOrEqual(yyDollar[1].s, yyDollar[4].s, false)
+			yylex.(*lexerWrapper).logDebugGrammarf("FUZZY STRING - %s %s", yyDollar[1].s, yyDollar[2].s)
+			n, err := queryStringStringTokenFuzzy(yyDollar[1].s, yyDollar[2].s)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[2].start, yyDollar[2].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[2].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[2].end)
 			}
-			yyVAL.q = q
 		}
-	case 17:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line query_string.y:147
+	case 26:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:227
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN OR EQUAL %s", yyDollar[5].s)
-			q, err := queryStringNumericRangeGreaterThanOrEqual(yyDollar[1].s, yyDollar[5].s, true)
+			yylex.(*lexerWrapper).logDebugGrammarf("NUMBER - %s", yyDollar[1].s)
+			n, err := queryStringNumberToken(yyDollar[1].s)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[1].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[1].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[1].end)
 			}
-			yyVAL.q = q
 		}
-	case 18:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line query_string.y:156
+	case 27:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:238
+		{
+			yylex.(*lexerWrapper).logDebugGrammarf("PHRASE - %s", yyDollar[1].s)
+			yyVAL.node = withSpan(queryStringPhraseToken(yyDollar[1].s), yyDollar[1].start, yyDollar[1].end)
+		}
+	case 28:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:243
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN %s", yyDollar[4].s)
-			q, err := queryStringNumericRangeLessThanOrEqual(yyDollar[1].s, yyDollar[4].s, false)
+			yylex.(*lexerWrapper).logDebugGrammarf("SLOPPY PHRASE - %s %s", yyDollar[1].s, yyDollar[2].s)
+			n, err := queryStringPhraseTokenSlop(yyDollar[1].s, yyDollar[2].s)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[2].start, yyDollar[2].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[2].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[2].end)
 			}
-			yyVAL.q = q
 		}
-	case 19:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line query_string.y:165
+	case 29:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:254
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN OR EQUAL %s", yyDollar[5].s)
-			q, err := queryStringNumericRangeLessThanOrEqual(yyDollar[1].s, yyDollar[5].s, true)
+			yylex.(*lexerWrapper).logDebugGrammarf("GREATER THAN %s", yyDollar[2].rb.value)
+			n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), yyDollar[2].rb, openRangeBound, false, true)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[2].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[2].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[2].end)
 			}
-			yyVAL.q = q
 		}
-	case 20:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line query_string.y:174
+	case 30:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line query_string.y:265
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN DATE %s", yyDollar[4].s)
-			q, err := queryStringDateRangeGreaterThanOrEqual(yylex, yyDollar[1].s, yyDollar[4].s, false)
+			yylex.(*lexerWrapper).logDebugGrammarf("GREATER THAN OR EQUAL %s", yyDollar[3].rb.value)
+			n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), yyDollar[3].rb, openRangeBound, true, true)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[3].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[3].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[3].end)
 			}
-			yyVAL.q = q
 		}
-	case 21:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line query_string.y:183
+	case 31:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:276
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - GREATER THAN OR EQUAL DATE %s", yyDollar[5].s)
-			q, err := queryStringDateRangeGreaterThanOrEqual(yylex, yyDollar[1].s, yyDollar[5].s, true)
+			yylex.(*lexerWrapper).logDebugGrammarf("LESS THAN %s", yyDollar[2].rb.value)
+			n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), openRangeBound, yyDollar[2].rb, true, false)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[2].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[2].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[2].end)
 			}
-			yyVAL.q = q
 		}
-	case 22:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line query_string.y:192
+	case 32:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line query_string.y:287
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN DATE %s", yyDollar[4].s)
-			q, err := queryStringDateRangeLessThanOrEqual(yylex, yyDollar[1].s, yyDollar[4].s, false)
+			yylex.(*lexerWrapper).logDebugGrammarf("LESS THAN OR EQUAL %s", yyDollar[3].rb.value)
+			n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), openRangeBound, yyDollar[3].rb, true, true)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[3].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[3].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[3].end)
 			}
-			yyVAL.q = q
 		}
-	case 23:
+	case 33:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line query_string.y:201
+//line query_string.y:298
 		{
-			yylex.(*lexerWrapper).logDebugGrammarf("FIELD - LESS THAN OR EQUAL DATE %s", yyDollar[5].s)
-			q, err := queryStringDateRangeLessThanOrEqual(yylex, yyDollar[1].s, yyDollar[5].s, true)
+			yylex.(*lexerWrapper).logDebugGrammarf("RANGE %s TO %s", yyDollar[2].rb.value, yyDollar[4].rb.value)
+			n, err := queryStringRange(yylex, yylex.(*lexerWrapper).field(), yyDollar[2].rb, yyDollar[4].rb, yyDollar[1].b, yyDollar[5].b)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[5].end, err)
+				yyVAL.node = yylex.(*lexerWrapper).badNode(yyDollar[1].start, yyDollar[5].end)
+			} else {
+				yyVAL.node = withSpan(n, yyDollar[1].start, yyDollar[5].end)
 			}
-			yyVAL.q = q
 		}
-	case 24:
+	case 34:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:310
+		{
+			yylex.(*lexerWrapper).startGroup()
+		}
+	case 35:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:315
+		{
+			yyVAL.b = true
+		}
+	case 36:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:319
+		{
+			yyVAL.b = false
+		}
+	case 37:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:324
+		{
+			yyVAL.b = true
+		}
+	case 38:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:328
+		{
+			yyVAL.b = false
+		}
+	case 39:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:333
+		{
+			yyVAL.rb = rangeBound{value: yyDollar[1].s, number: true}
+		}
+	case 40:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:337
+		{
+			yyVAL.rb = rangeBound{value: yyDollar[1].s, phrase: true}
+		}
+	case 41:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:341
+		{
+			yyVAL.rb = rangeBound{value: yyDollar[1].s, phrase: true, zone: yyDollar[2].s}
+			yyVAL.end = yyDollar[2].end
+		}
+	case 42:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:346
+		{
+			yyVAL.rb = rangeBound{value: yyDollar[1].s, isoDate: true}
+		}
+	case 43:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:350
+		{
+			yyVAL.rb = rangeBound{value: yyDollar[1].s, isoDate: true, zone: yyDollar[2].s}
+			yyVAL.end = yyDollar[2].end
+		}
+	case 44:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:355
+		{
+			yyVAL.rb = rangeBound{value: yyDollar[1].s}
+		}
+	case 45:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line query_string.y:211
+//line query_string.y:360
 		{
 			yyVAL.pf = nil
 		}
-	case 25:
+	case 46:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:215
+//line query_string.y:364
 		{
 			yyVAL.pf = nil
 			yylex.(*lexerWrapper).logDebugGrammarf("BOOST %s", yyDollar[1].s)
 			boost, err := queryStringParseBoost(yyDollar[1].s)
 			if err != nil {
-				yylex.(*lexerWrapper).lex.Error(err.Error())
+				yylex.(*lexerWrapper).errorAt(yyDollar[1].start, yyDollar[1].end, err)
 			} else {
 				yyVAL.pf = &boost
 			}
 		}
-	case 26:
+	case 47:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line query_string.y:227
+//line query_string.y:376
 		{
 			yyVAL.s = yyDollar[1].s
 		}
-	case 27:
+	case 48:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line query_string.y:231
+//line query_string.y:380
 		{
 			yyVAL.s = "-" + yyDollar[2].s
+			yyVAL.end = yyDollar[2].end
 		}
 	}
 	goto yystack /* stack new state and value */
@@ -0,0 +1,280 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"time"
+
+	"github.com/blugelabs/bluge/numeric/geo"
+)
+
+// Prefix is the operator in front of a clause
+// which decides how it joins the enclosing query
+type Prefix int
+
+const (
+	// NoPrefix leaves the clause to the default operator
+	NoPrefix Prefix = iota
+	// MustPrefix, a +, requires the clause to match
+	MustPrefix
+	// MustNotPrefix, a -, requires the clause not to match
+	MustNotPrefix
+)
+
+// Node is a node of the syntax tree of a query string
+type Node interface {
+	// Span returns the byte offsets of the start
+	// and the end of the node in the query string
+	Span() (start, end int)
+	base() *NodeBase
+}
+
+// NodeBase holds what all nodes have in common
+type NodeBase struct {
+	// Start and End are the byte offsets of the node in
+	// the query string, End is the offset following it
+	Start, End int
+	Prefix     Prefix
+	// Field is the field the node is searched in, when empty the
+	// field of the enclosing group or the default fields are used
+	Field string
+	// Boost is nil when the node has no boost
+	Boost *float64
+}
+
+func (b *NodeBase) Span() (start, end int) {
+	return b.Start, b.End
+}
+
+func (b *NodeBase) base() *NodeBase {
+	return b
+}
+
+// Group is a sequence of clauses, the whole
+// query or a group between parentheses
+type Group struct {
+	NodeBase
+	Clauses []Node
+}
+
+// Or is a sequence of clauses joined by OR, any of which may match
+type Or struct {
+	NodeBase
+	Clauses []Node
+}
+
+// And is a sequence of clauses joined by AND, all of which must match
+type And struct {
+	NodeBase
+	Clauses []Node
+}
+
+// Not is a clause negated by NOT
+type Not struct {
+	NodeBase
+	Clause Node
+}
+
+// Term is a single term, like marty
+type Term struct {
+	NodeBase
+	Term string
+}
+
+// Fuzzy is a term matching terms within an edit distance, like marty~2
+type Fuzzy struct {
+	NodeBase
+	Term      string
+	Fuzziness int
+}
+
+// Number is a number, which matches both
+// the term and the numeric value
+type Number struct {
+	NodeBase
+	Text  string
+	Value float64
+}
+
+// Phrase is a quoted phrase, the slop allows
+// its terms to be apart, like "quick fox"~2
+type Phrase struct {
+	NodeBase
+	Phrase string
+	Slop   int
+}
+
+// Wildcard is a term with * or ? wildcards, like mart*
+type Wildcard struct {
+	NodeBase
+	Pattern string
+}
+
+// Regexp is a regular expression between slashes, like /mar.*ty/
+type Regexp struct {
+	NodeBase
+	Pattern string
+}
+
+// NumericRange is a range of numbers, a nil end is unbounded
+type NumericRange struct {
+	NodeBase
+	Min, Max                   *float64
+	MinInclusive, MaxInclusive bool
+}
+
+// DateRange is a range of dates
+type DateRange struct {
+	NodeBase
+	Min, Max                   DateBound
+	MinInclusive, MaxInclusive bool
+}
+
+// DateBound is one end of a date range
+type DateBound struct {
+	// Value is the date as written, like 2024-05-01
+	// or now-1d/d, it is empty when unbounded
+	Value string
+	// Zone is the time zone written after the date, if any
+	Zone string
+	// Time is the time the date resolved to
+	Time time.Time
+}
+
+// TermRange is a range of terms, an empty end is unbounded
+type TermRange struct {
+	NodeBase
+	Min, Max                   string
+	MinInclusive, MaxInclusive bool
+}
+
+// GeoDistance matches points within a distance
+// of a location, like near(37.77,-122.41,5km)
+type GeoDistance struct {
+	NodeBase
+	Lat, Lon float64
+	Distance string
+}
+
+// GeoBoundingBox matches points within a box,
+// like bbox(37.79,-122.45,37.75,-122.39)
+type GeoBoundingBox struct {
+	NodeBase
+	TopLeftLat, TopLeftLon         float64
+	BottomRightLat, BottomRightLon float64
+}
+
+// GeoPolygon matches points within a polygon, the
+// points don't repeat the first point at the end
+type GeoPolygon struct {
+	NodeBase
+	Points []geo.Point
+}
+
+// Bad is a value which failed to parse, like marty~x,
+// the query string has an error for it
+type Bad struct {
+	NodeBase
+	// Text is the value as written
+	Text string
+}
+
+// ParseAST parses a query string into its syntax tree, the root
+// is a group holding the clauses of the query.  Unlike with
+// ParseQueryString, the default fields, the default operator
+// and minimum should match options are left to the compilation
+// of the tree.  With partial results the tree of the clauses
+// which parsed is returned together with the errors, values
+// which failed to parse are Bad nodes in the tree.
+func ParseAST(query string, options QueryStringOptions) (*Group, error) {
+	if query == "" {
+		return &Group{}, nil
+	}
+	lexer := newQueryStringLex(query, options)
+	lex := newLexerWrapper(lexer, query, options)
+	doParse(lex)
+
+	errs := append(lexer.errs, lex.errs...)
+	if len(errs) > 0 {
+		rv := ParseErrors(errs)
+		rv.sort()
+		for _, err := range rv {
+			err.locate(query)
+		}
+		if !options.partialResults {
+			return nil, rv
+		}
+		if lex.root == nil {
+			// the parser gave up on the query
+			return &Group{}, rv
+		}
+		return lex.root, rv
+	}
+	return lex.root, nil
+}
+
+// withSpan sets the byte offsets of a node
+func withSpan(n Node, start, end int) Node {
+	base := n.base()
+	base.Start, base.End = start, end
+	return n
+}
+
+// nodeSpan sets the span of a node from the first to the last node
+func nodeSpan(base *NodeBase, nodes []Node) {
+	base.Start, _ = nodes[0].Span()
+	_, base.End = nodes[len(nodes)-1].Span()
+}
+
+func newGroup(clauses []Node) *Group {
+	rv := &Group{Clauses: clauses}
+	if len(clauses) > 0 {
+		nodeSpan(&rv.NodeBase, clauses)
+	}
+	return rv
+}
+
+// newOr joins the clauses of an OR expression,
+// a single clause is returned unchanged
+func newOr(clauses []Node) Node {
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+	rv := &Or{Clauses: clauses}
+	nodeSpan(&rv.NodeBase, clauses)
+	requireOperator(&rv.NodeBase, clauses)
+	return rv
+}
+
+// newAnd joins the clauses of an AND expression,
+// a single clause is returned unchanged
+func newAnd(clauses []Node) Node {
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+	rv := &And{Clauses: clauses}
+	nodeSpan(&rv.NodeBase, clauses)
+	requireOperator(&rv.NodeBase, clauses)
+	return rv
+}
+
+// requireOperator moves the + of the first clause of an operator to
+// the operator, so that +a AND b requires the whole expression, the
+// + of an operand would be lost as the operands are joined
+func requireOperator(base *NodeBase, clauses []Node) {
+	if first := clauses[0].base(); first.Prefix == MustPrefix {
+		base.Prefix, first.Prefix = MustPrefix, NoPrefix
+	}
+}
@@ -0,0 +1,208 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blugelabs/bluge/numeric/geo"
+)
+
+func TestParseAST(t *testing.T) {
+	boost := func(b float64) *float64 {
+		return &b
+	}
+	number := func(n float64) *float64 {
+		return &n
+	}
+
+	tests := []struct {
+		input  string
+		result *Group
+	}{
+		{
+			input:  ``,
+			result: &Group{},
+		},
+		{
+			input: `marty`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 5},
+				Clauses: []Node{
+					&Term{NodeBase: NodeBase{Start: 0, End: 5}, Term: "marty"},
+				},
+			},
+		},
+		{
+			input: `+name:marty^2 -"quick fox"~3`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 28},
+				Clauses: []Node{
+					&Term{
+						NodeBase: NodeBase{Start: 0, End: 13, Prefix: MustPrefix, Field: "name", Boost: boost(2)},
+						Term:     "marty",
+					},
+					&Phrase{
+						NodeBase: NodeBase{Start: 14, End: 28, Prefix: MustNotPrefix},
+						Phrase:   "quick fox",
+						Slop:     3,
+					},
+				},
+			},
+		},
+		{
+			input: `mart* /ma.*y/ marty~1 age:-5`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 28},
+				Clauses: []Node{
+					&Wildcard{NodeBase: NodeBase{Start: 0, End: 5}, Pattern: "mart*"},
+					&Regexp{NodeBase: NodeBase{Start: 6, End: 13}, Pattern: "ma.*y"},
+					&Fuzzy{NodeBase: NodeBase{Start: 14, End: 21}, Term: "marty", Fuzziness: 1},
+					&Number{NodeBase: NodeBase{Start: 22, End: 28, Field: "age"}, Text: "-5", Value: -5},
+				},
+			},
+		},
+		{
+			input: `a AND b OR NOT c`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 16},
+				Clauses: []Node{
+					&Or{
+						NodeBase: NodeBase{Start: 0, End: 16},
+						Clauses: []Node{
+							&And{
+								NodeBase: NodeBase{Start: 0, End: 7},
+								Clauses: []Node{
+									&Term{NodeBase: NodeBase{Start: 0, End: 1}, Term: "a"},
+									&Term{NodeBase: NodeBase{Start: 6, End: 7}, Term: "b"},
+								},
+							},
+							&Not{
+								NodeBase: NodeBase{Start: 11, End: 16},
+								Clause:   &Term{NodeBase: NodeBase{Start: 15, End: 16}, Term: "c"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			input: `title:(a b)^3`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 13},
+				Clauses: []Node{
+					&Group{
+						NodeBase: NodeBase{Start: 0, End: 13, Field: "title", Boost: boost(3)},
+						Clauses: []Node{
+							&Term{NodeBase: NodeBase{Start: 7, End: 8}, Term: "a"},
+							&Term{NodeBase: NodeBase{Start: 9, End: 10}, Term: "b"},
+						},
+					},
+				},
+			},
+		},
+		{
+			input: `age:>=18 price:{1 TO 5] name:[a TO *]`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 37},
+				Clauses: []Node{
+					&NumericRange{
+						NodeBase:     NodeBase{Start: 0, End: 8, Field: "age"},
+						Min:          number(18),
+						MinInclusive: true,
+						MaxInclusive: true,
+					},
+					&NumericRange{
+						NodeBase:     NodeBase{Start: 9, End: 23, Field: "price"},
+						Min:          number(1),
+						Max:          number(5),
+						MaxInclusive: true,
+					},
+					&TermRange{
+						NodeBase:     NodeBase{Start: 24, End: 37, Field: "name"},
+						Min:          "a",
+						MinInclusive: true,
+						MaxInclusive: true,
+					},
+				},
+			},
+		},
+		{
+			input: `created:<2024-05-01@UTC`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 23},
+				Clauses: []Node{
+					&DateRange{
+						NodeBase: NodeBase{Start: 0, End: 23, Field: "created"},
+						Max: DateBound{
+							Value: "2024-05-01",
+							Zone:  "UTC",
+							Time:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+						},
+						MinInclusive: true,
+					},
+				},
+			},
+		},
+		{
+			input: `loc:near(1,2,3km) loc:polygon((0 0),(0 1),(1 1),(0 0))`,
+			result: &Group{
+				NodeBase: NodeBase{Start: 0, End: 54},
+				Clauses: []Node{
+					&GeoDistance{
+						NodeBase: NodeBase{Start: 0, End: 17, Field: "loc"},
+						Lat:      1,
+						Lon:      2,
+						Distance: "3km",
+					},
+					&GeoPolygon{
+						NodeBase: NodeBase{Start: 18, End: 54, Field: "loc"},
+						Points:   []geo.Point{{Lon: 0, Lat: 0}, {Lon: 1, Lat: 0}, {Lon: 1, Lat: 1}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		result, err := ParseAST(test.input, DefaultOptions())
+		if err != nil {
+			t.Fatalf("unexpected error %v for %s", err, test.input)
+		}
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("expected %#v, got %#v for %s", test.result, result, test.input)
+		}
+	}
+}
+
+func TestParseASTSpans(t *testing.T) {
+	input := `  +f:"a b"~2^3 (x AND y)   `
+	root, err := ParseAST(input, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{`+f:"a b"~2^3`, `(x AND y)`}
+	if len(root.Clauses) != len(expect) {
+		t.Fatalf("expected %d clauses, got %d", len(expect), len(root.Clauses))
+	}
+	for i, n := range root.Clauses {
+		start, end := n.Span()
+		if input[start:end] != expect[i] {
+			t.Errorf("expected span %q, got %q", expect[i], input[start:end])
+		}
+	}
+}
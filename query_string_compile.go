@@ -0,0 +1,326 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blugelabs/bluge"
+)
+
+// compiler builds the bluge query of a syntax tree
+type compiler struct {
+	fields          []string
+	defaultPrefix   int
+	defaultFields   map[string]float64
+	minShould       minimumShouldMatch
+	minPrefixLength int
+	lenient         bool
+	// errs are the errors of the clauses left out
+	errs []*ParseError
+}
+
+func newCompiler(options QueryStringOptions, minShould minimumShouldMatch) *compiler {
+	defaultPrefix := queryShould
+	if options.defaultOperator == AndOperator {
+		defaultPrefix = queryMust
+	}
+	return &compiler{
+		defaultPrefix:   defaultPrefix,
+		defaultFields:   options.defaultFields,
+		minShould:       minShould,
+		minPrefixLength: options.minPrefixLength,
+		lenient:         options.lenient,
+	}
+}
+
+// compileRoot builds the query of the root group,
+// an empty query matches no documents
+func (c *compiler) compileRoot(root *Group) (bluge.Query, error) {
+	bq, err := c.compileGroup(root)
+	if err != nil {
+		return nil, err
+	} else if bq == nil {
+		return bluge.NewMatchNoneQuery(), nil
+	}
+	return bq, nil
+}
+
+// compileClause builds the query of a node together with the
+// prefix it joins the enclosing query with, the query is nil
+// when there is nothing to search as the values are Bad nodes
+func (c *compiler) compileClause(n Node) (clause, error) {
+	base := n.base()
+	if base.Field != "" {
+		c.pushField(base.Field)
+		defer c.popField()
+	}
+
+	var rv clause
+	switch v := n.(type) {
+	case *Not:
+		operand, err := c.compileClause(v.Clause)
+		if err != nil || operand.query == nil {
+			return clause{}, err
+		}
+		rv = clause{prefix: queryMustNot, query: clauseQuery(operand)}
+	default:
+		q, err := c.compileQuery(n)
+		if err != nil || q == nil {
+			return clause{}, err
+		}
+		rv = clause{prefix: c.prefix(base.Prefix), query: q}
+	}
+
+	if base.Boost != nil {
+		boost := *base.Boost
+		if b, ok := rv.query.(interface{ Boost() float64 }); ok {
+			// the boost of a default field is multiplied, not replaced
+			boost *= b.Boost()
+		}
+		boosted, err := queryStringSetBoost(rv.query, boost)
+		if err != nil && c.lenient {
+			// the boost is ignored
+			c.errs = append(c.errs, nodeError(n, err))
+		} else if err != nil {
+			return clause{}, err
+		} else {
+			rv.query = boosted
+		}
+	}
+	return rv, nil
+}
+
+func (c *compiler) prefix(prefix Prefix) int {
+	switch prefix {
+	case MustPrefix:
+		return queryMust
+	case MustNotPrefix:
+		return queryMustNot
+	}
+	return c.defaultPrefix
+}
+
+// compileClauses builds the clauses of nodes, clauses with
+// errors in the query string are left out and their errors
+// recorded, so that all the errors are reported together
+func (c *compiler) compileClauses(nodes []Node) ([]clause, error) {
+	rv := make([]clause, 0, len(nodes))
+	for _, n := range nodes {
+		cl, err := c.compileClause(n)
+		if perr, ok := err.(*ParseError); ok {
+			c.errs = append(c.errs, perr)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if cl.query != nil {
+			rv = append(rv, cl)
+		}
+	}
+	return rv, nil
+}
+
+// compileGroup builds the boolean query of a group,
+// which is nil when none of its clauses has a query
+func (c *compiler) compileGroup(g *Group) (*bluge.BooleanQuery, error) {
+	clauses, err := c.compileClauses(g.Clauses)
+	if err != nil || len(clauses) == 0 {
+		return nil, err
+	}
+	bq := bluge.NewBooleanQuery()
+	for _, cl := range clauses {
+		addClause(bq, cl)
+	}
+	return c.applyMinShould(bq), nil
+}
+
+// compileQuery builds the query of a node in the current field
+func (c *compiler) compileQuery(n Node) (bluge.Query, error) {
+	switch v := n.(type) {
+	case *Bad:
+		if c.lenient {
+			return c.compileText(v.Text)
+		}
+		return nil, nil
+	case *Group:
+		bq, err := c.compileGroup(v)
+		if bq == nil {
+			return nil, err
+		}
+		return bq, nil
+	case *Or:
+		clauses, err := c.compileClauses(v.Clauses)
+		if err != nil || len(clauses) == 0 {
+			return nil, err
+		}
+		return clauseQuery(queryStringOr(clauses, c.defaultPrefix)), nil
+	case *And:
+		clauses, err := c.compileClauses(v.Clauses)
+		if err != nil || len(clauses) == 0 {
+			return nil, err
+		}
+		return clauseQuery(queryStringAnd(clauses, c.defaultPrefix)), nil
+	case *Term:
+		return c.inFields(func(field string) (bluge.Query, error) {
+			if field == existsField {
+				return NewExistsQuery(v.Term), nil
+			}
+			return bluge.NewMatchQuery(v.Term).SetField(field), nil
+		})
+	case *Wildcard:
+		q, err := c.inFields(func(field string) (bluge.Query, error) {
+			return c.compileWildcard(field, v.Pattern)
+		})
+		if err != nil && c.lenient {
+			c.errs = append(c.errs, nodeError(v, err))
+			return c.compileText(v.Pattern)
+		} else if err != nil {
+			return nil, nodeError(v, err)
+		}
+		return q, nil
+	case *Regexp:
+		return c.inFields(func(field string) (bluge.Query, error) {
+			return bluge.NewRegexpQuery(v.Pattern).SetField(field), nil
+		})
+	case *Fuzzy:
+		return c.inFields(func(field string) (bluge.Query, error) {
+			return bluge.NewMatchQuery(v.Term).SetFuzziness(v.Fuzziness).SetField(field), nil
+		})
+	case *Number:
+		return c.inFields(func(field string) (bluge.Query, error) {
+			return bluge.NewBooleanQuery().AddShould(
+				bluge.NewMatchQuery(v.Text).SetField(field),
+				bluge.NewNumericRangeInclusiveQuery(v.Value, v.Value, true, true).SetField(field),
+			), nil
+		})
+	case *Phrase:
+		return c.inFields(func(field string) (bluge.Query, error) {
+			return bluge.NewMatchPhraseQuery(v.Phrase).SetSlop(v.Slop).SetField(field), nil
+		})
+	case *NumericRange:
+		minVal, maxVal := bluge.MinNumeric, bluge.MaxNumeric
+		if v.Min != nil {
+			minVal = *v.Min
+		}
+		if v.Max != nil {
+			maxVal = *v.Max
+		}
+		return bluge.NewNumericRangeInclusiveQuery(minVal, maxVal, v.MinInclusive, v.MaxInclusive).
+			SetField(c.field()), nil
+	case *DateRange:
+		return bluge.NewDateRangeInclusiveQuery(v.Min.Time, v.Max.Time, v.MinInclusive, v.MaxInclusive).
+			SetField(c.field()), nil
+	case *TermRange:
+		return bluge.NewTermRangeInclusiveQuery(v.Min, v.Max, v.MinInclusive, v.MaxInclusive).
+			SetField(c.field()), nil
+	case *GeoDistance:
+		return bluge.NewGeoDistanceQuery(v.Lon, v.Lat, v.Distance).SetField(c.field()), nil
+	case *GeoBoundingBox:
+		return bluge.NewGeoBoundingBoxQuery(v.TopLeftLon, v.TopLeftLat, v.BottomRightLon, v.BottomRightLat).
+			SetField(c.field()), nil
+	case *GeoPolygon:
+		return bluge.NewGeoBoundingPolygonQuery(v.Points).SetField(c.field()), nil
+	}
+	return nil, fmt.Errorf("cannot compile %T", n)
+}
+
+// compileText builds the query searching for text in the current field,
+// lenient compilation searches for the values which failed to parse
+func (c *compiler) compileText(text string) (bluge.Query, error) {
+	return c.inFields(func(field string) (bluge.Query, error) {
+		return bluge.NewMatchQuery(text).SetField(field), nil
+	})
+}
+
+func (c *compiler) compileWildcard(field, pattern string) (bluge.Query, error) {
+	if field == existsField {
+		return NewExistsQuery(pattern), nil
+	} else if prefix, ok := prefixOf(pattern); ok {
+		if utf8.RuneCountInString(prefix) < c.minPrefixLength {
+			return nil, fmt.Errorf("prefix %s is shorter than %d characters", pattern, c.minPrefixLength)
+		}
+		return bluge.NewPrefixQuery(prefix).SetField(field), nil
+	} else if c.minPrefixLength > 0 && strings.IndexAny(pattern, "*?") == 0 {
+		// a pattern starting with a wildcard has no prefix at all
+		return nil, fmt.Errorf("prefix %s is shorter than %d characters", pattern, c.minPrefixLength)
+	}
+	return bluge.NewWildcardQuery(pattern).SetField(field), nil
+}
+
+// pushField makes field the current field until the matching popField,
+// nodes without a field of their own are searched in the current field
+func (c *compiler) pushField(field string) {
+	c.fields = append(c.fields, field)
+}
+
+func (c *compiler) popField() {
+	c.fields = c.fields[:len(c.fields)-1]
+}
+
+func (c *compiler) field() string {
+	if len(c.fields) == 0 {
+		return ""
+	}
+	return c.fields[len(c.fields)-1]
+}
+
+// inFields builds the query for a value in the current field, without
+// a current field the value is searched in each of the default fields
+func (c *compiler) inFields(build func(field string) (bluge.Query, error)) (bluge.Query, error) {
+	if c.field() != "" || len(c.defaultFields) == 0 {
+		return build(c.field())
+	}
+
+	fields := make([]string, 0, len(c.defaultFields))
+	for field := range c.defaultFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	bq := bluge.NewBooleanQuery()
+	for _, field := range fields {
+		q, err := build(field)
+		if err != nil {
+			return nil, err
+		}
+		if boost := c.defaultFields[field]; boost != noBoost {
+			q, err = queryStringSetBoost(q, boost)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(fields) == 1 {
+			return q, nil
+		}
+		bq.AddShould(q)
+	}
+	return bq, nil
+}
+
+// applyMinShould sets the number of should clauses
+// of the query which must match
+func (c *compiler) applyMinShould(bq *bluge.BooleanQuery) *bluge.BooleanQuery {
+	if c.minShould == nil {
+		return bq
+	}
+	if required := c.minShould.required(len(bq.Shoulds())); required > 0 {
+		bq.SetMinShould(required)
+	}
+	return bq
+}
@@ -0,0 +1,89 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// time zones given in queries are resolved without a system tz database
+	_ "time/tzdata"
+)
+
+// Date format names which are accepted in place of a time
+// layout, for dates given as a number of seconds or
+// milliseconds since the unix epoch
+const (
+	EpochSeconds = "epoch_second"
+	EpochMillis  = "epoch_millis"
+)
+
+// Layouts of ISO 8601 dates and date-times without a time zone
+const (
+	DateOnly       = "2006-01-02"
+	DateTimeNoZone = "2006-01-02T15:04:05"
+	DateHourMinute = "2006-01-02T15:04"
+)
+
+// maxEpochSecondsDigits limits epoch seconds to 10 digits, so
+// that longer numbers are left for the epoch millis format
+const maxEpochSecondsDigits = 10
+
+// DefaultDateFormats are the date formats tried in turn when parsing
+// the dates of a date range.  Epoch dates are left out, as quoted
+// numbers would parse as dates, WithDateFormats can add them.
+var DefaultDateFormats = []string{
+	time.RFC3339,
+	DateTimeNoZone,
+	DateHourMinute,
+	DateOnly,
+	time.RFC1123,
+}
+
+// parseTimeFormats parses str with each of the formats in turn and
+// returns the first successful result, dates without a time zone
+// are in the location
+func parseTimeFormats(formats []string, str string, location *time.Location) (time.Time, error) {
+	for _, format := range formats {
+		if rv, err := parseTimeFormat(format, str, location); err == nil {
+			return rv, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q does not match any of the formats: %s",
+		str, strings.Join(formats, ", "))
+}
+
+func parseTimeFormat(format, str string, location *time.Location) (time.Time, error) {
+	switch format {
+	case EpochSeconds:
+		if len(strings.TrimPrefix(str, "-")) > maxEpochSecondsDigits {
+			return time.Time{}, fmt.Errorf("too many digits for epoch seconds: %s", str)
+		}
+		secs, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(secs, 0).In(location), nil
+	case EpochMillis:
+		millis, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, millis*int64(time.Millisecond)).In(location), nil
+	}
+	return time.ParseInLocation(format, str, location)
+}
@@ -0,0 +1,163 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	dateMathNow    = "now"
+	dateMathAnchor = "||"
+)
+
+// isDateMath reports whether the string is a date math expression,
+// which is anchored at now, followed by the end of the string or
+// an operation, or at an explicit date followed by ||, which
+// parseAnchor must parse
+func isDateMath(str string, parseAnchor func(string) (time.Time, error)) bool {
+	if strings.HasPrefix(str, dateMathNow) {
+		ops := str[len(dateMathNow):]
+		return ops == "" || ops[0] == '+' || ops[0] == '-' || ops[0] == '/'
+	}
+	i := strings.Index(str, dateMathAnchor)
+	if i <= 0 {
+		return false
+	}
+	_, err := parseAnchor(str[:i])
+	return err == nil
+}
+
+// parseDateMath resolves a date math expression like now-7d/d or
+// 2024-01-01||+1M/M.  The anchor is followed by any number of
+// operations, +N or -N units (the count defaults to 1) and /unit
+// rounding, where the units are y, M, w, d, h (or H), m and s.
+// Rounding goes down to the start of the unit, or when roundUp is
+// set up to the last millisecond of the unit.
+func parseDateMath(expr string, now time.Time, parseAnchor func(string) (time.Time, error),
+	roundUp bool) (time.Time, error) {
+	var rv time.Time
+	var ops string
+	if strings.HasPrefix(expr, dateMathNow) {
+		rv = now
+		ops = expr[len(dateMathNow):]
+	} else {
+		i := strings.Index(expr, dateMathAnchor)
+		if i < 0 {
+			return time.Time{}, fmt.Errorf("date math must start with now or a date followed by ||: %s", expr)
+		}
+		var err error
+		rv, err = parseAnchor(expr[:i])
+		if err != nil {
+			return time.Time{}, err
+		}
+		ops = expr[i+len(dateMathAnchor):]
+	}
+
+	for ops != "" {
+		op := ops[0]
+		ops = ops[1:]
+		switch op {
+		case '+', '-':
+			n := 0
+			digits := strings.IndexFunc(ops, func(r rune) bool {
+				return !unicode.IsDigit(r)
+			})
+			if digits < 0 {
+				return time.Time{}, fmt.Errorf("date math is missing a unit: %s", expr)
+			}
+			for _, d := range ops[:digits] {
+				n = n*10 + int(d-'0')
+			}
+			if digits == 0 {
+				n = 1
+			}
+			if op == '-' {
+				n = -n
+			}
+			var err error
+			rv, err = dateMathAdd(rv, ops[digits], n)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%v: %s", err, expr)
+			}
+			ops = ops[digits+1:]
+		case '/':
+			if ops == "" {
+				return time.Time{}, fmt.Errorf("date math is missing a unit: %s", expr)
+			}
+			var err error
+			rv, err = dateMathRound(rv, ops[0], roundUp)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%v: %s", err, expr)
+			}
+			ops = ops[1:]
+		default:
+			return time.Time{}, fmt.Errorf("invalid date math operation %q: %s", op, expr)
+		}
+	}
+	return rv, nil
+}
+
+func dateMathAdd(t time.Time, unit byte, n int) (time.Time, error) {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0), nil
+	case 'M':
+		return t.AddDate(0, n, 0), nil
+	case 'w':
+		return t.AddDate(0, 0, 7*n), nil
+	case 'd':
+		return t.AddDate(0, 0, n), nil
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case 's':
+		return t.Add(time.Duration(n) * time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date math unit %q", unit)
+}
+
+func dateMathRound(t time.Time, unit byte, roundUp bool) (time.Time, error) {
+	var rv time.Time
+	switch unit {
+	case 'y':
+		rv = time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+	case 'M':
+		rv = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case 'w':
+		// weeks start on monday
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		rv = time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, t.Location())
+	case 'd':
+		rv = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case 'h', 'H':
+		rv = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case 'm':
+		rv = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+	case 's':
+		rv = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	default:
+		return time.Time{}, fmt.Errorf("invalid date math unit %q", unit)
+	}
+	if roundUp {
+		next, _ := dateMathAdd(rv, unit, 1)
+		rv = next.Add(-time.Millisecond)
+	}
+	return rv, nil
+}
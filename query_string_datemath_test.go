@@ -0,0 +1,86 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateMath(t *testing.T) {
+	// a wednesday
+	now := time.Date(2024, 5, 15, 10, 30, 45, 500, time.UTC)
+	parse := func(t string) (time.Time, error) {
+		return time.Parse(time.RFC3339, t)
+	}
+	tests := []struct {
+		expr    string
+		roundUp bool
+		result  time.Time
+	}{
+		{expr: "now", result: now},
+		{expr: "now-24h", result: now.Add(-24 * time.Hour)},
+		{expr: "now+1y-2M", result: time.Date(2025, 3, 15, 10, 30, 45, 500, time.UTC)},
+		{expr: "now-d", result: time.Date(2024, 5, 14, 10, 30, 45, 500, time.UTC)},
+		{expr: "now+2w", result: time.Date(2024, 5, 29, 10, 30, 45, 500, time.UTC)},
+		{expr: "now-90m+30s", result: time.Date(2024, 5, 15, 9, 1, 15, 500, time.UTC)},
+		{expr: "now/y", result: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "now/M", result: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "now/w", result: time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{expr: "now/d", result: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{expr: "now/H", result: time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)},
+		{expr: "now/m", result: time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)},
+		{expr: "now/s", result: time.Date(2024, 5, 15, 10, 30, 45, 0, time.UTC)},
+		{expr: "now/d", roundUp: true, result: time.Date(2024, 5, 15, 23, 59, 59, 999000000, time.UTC)},
+		{expr: "now/w", roundUp: true, result: time.Date(2024, 5, 19, 23, 59, 59, 999000000, time.UTC)},
+		{expr: "now-1M/M", roundUp: true, result: time.Date(2024, 4, 30, 23, 59, 59, 999000000, time.UTC)},
+		{expr: "2024-01-31T12:00:00Z||", result: time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{expr: "2024-01-31T12:00:00Z||+1M/d", result: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		result, err := parseDateMath(test.expr, now, parse, test.roundUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Equal(test.result) {
+			t.Errorf("expected %v, got %v for %s", test.result, result, test.expr)
+		}
+	}
+}
+
+func TestParseDateMathInvalid(t *testing.T) {
+	now := time.Now()
+	parse := func(t string) (time.Time, error) {
+		return time.Parse(time.RFC3339, t)
+	}
+	tests := []string{
+		"yesterday",
+		"now-",
+		"now-1",
+		"now-1x",
+		"now/",
+		"now/q",
+		"now*2d",
+		"2024-13-01T00:00:00Z||+1d",
+	}
+
+	for _, test := range tests {
+		_, err := parseDateMath(test, now, parse, false)
+		if err == nil {
+			t.Errorf("expected error, got nil for `%s`", test)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError is a problem at a position of a query string
+type ParseError struct {
+	// Offset is the byte offset of the problem in the query string
+	Offset int
+	// Line and Column are the position of the offset, both
+	// starting at 1, the column counts runes
+	Line, Column int
+	// Token is the text at the offset the problem is about,
+	// it is empty at the end of the query string
+	Token string
+	// Expected are the tokens which could have come
+	// instead of Token, for syntax errors
+	Expected []string
+	Msg      string
+
+	// end is the byte offset following Token
+	end int
+	// unexpected is the token of a syntax error,
+	// numbered as in the parser tables
+	unexpected int
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// locate fills in the line, column and token of
+// the error from the query string it was found in
+func (e *ParseError) locate(query string) {
+	if e.Offset > len(query) {
+		e.Offset = len(query)
+	}
+	if e.end < e.Offset {
+		e.end = e.Offset
+	} else if e.end > len(query) {
+		e.end = len(query)
+	}
+	before := query[:e.Offset]
+	e.Line = strings.Count(before, "\n") + 1
+	e.Column = utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	e.Token = query[e.Offset:e.end]
+}
+
+// ParseErrors are the problems found in a query string, in the
+// order of their offsets, callers can get them with errors.As
+type ParseErrors []*ParseError
+
+// sort orders the errors by their offsets
+func (e ParseErrors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		return e[i].Offset < e[j].Offset
+	})
+}
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// newParseError returns the error of the query
+// string text from byte offset start up to end
+func newParseError(start, end int, msg string) *ParseError {
+	return &ParseError{Offset: start, end: end, Msg: msg}
+}
+
+// nodeError returns the error of the text of a node
+func nodeError(n Node, err error) *ParseError {
+	start, end := n.Span()
+	return newParseError(start, end, err.Error())
+}
+
+// tokenNames are the names of the tokens in syntax errors
+var tokenNames = map[string]string{
+	"$end":      "end of query",
+	"tSTRING":   "term",
+	"tPHRASE":   "phrase",
+	"tPLUS":     "+",
+	"tMINUS":    "-",
+	"tCOLON":    ":",
+	"tBOOST":    "boost",
+	"tNUMBER":   "number",
+	"tGREATER":  ">",
+	"tLESS":     "<",
+	"tEQUAL":    "=",
+	"tTILDE":    "~",
+	"tLPAREN":   "(",
+	"tRPAREN":   ")",
+	"tAND":      "AND",
+	"tOR":       "OR",
+	"tNOT":      "NOT",
+	"tLBRACKET": "[",
+	"tRBRACKET": "]",
+	"tLBRACE":   "{",
+	"tRBRACE":   "}",
+	"tTO":       "TO",
+	"tFUNCTION": "function",
+	"tZONE":     "time zone",
+	"tDATE":     "date",
+}
+
+// tokenName returns the name of a token numbered as in the parser tables
+func tokenName(token int) string {
+	name := yyTokname(token)
+	if rv, ok := tokenNames[name]; ok {
+		return rv
+	}
+	return name
+}
+
+// syntaxError returns the error of the last of the tokens
+// the parser read, which it didn't expect, the tokens are
+// numbered as in the parser tables, the expected tokens
+// are only named when expected is set
+func syntaxError(tokens []int, start, end int, expected bool) *ParseError {
+	unexpected := tokens[len(tokens)-1]
+	rv := newParseError(start, end, "syntax error: unexpected "+tokenName(unexpected))
+	rv.unexpected = unexpected
+	if expected {
+		rv.Expected = expectedTokens(tokens[:len(tokens)-1])
+	}
+	if len(rv.Expected) > 0 {
+		rv.Msg += ", expecting " + strings.Join(rv.Expected[:len(rv.Expected)-1], ", ")
+		if len(rv.Expected) > 1 {
+			rv.Msg += " or "
+		}
+		rv.Msg += rv.Expected[len(rv.Expected)-1]
+	}
+	return rv
+}
+
+// expectedTokens returns the names of the tokens
+// the parser accepts following the tokens
+func expectedTokens(tokens []int) []string {
+	var rv []string
+	for token := yyEofCode; token <= len(yyToknames); token++ {
+		if tokenNames[yyTokname(token)] == "" {
+			// error and unknown tokens
+			continue
+		}
+		if parserAccepts(tokens, token) {
+			rv = append(rv, tokenName(token))
+		}
+	}
+	return rv
+}
+
+// parserAccepts reports whether the parser shifts the last token
+// following the tokens, by running the parser tables without the
+// actions of the grammar, recovering from the syntax errors of the
+// tokens as the parser does
+func parserAccepts(tokens []int, last int) bool {
+	input := append(tokens[:len(tokens):len(tokens)], last)
+	stack := []int{0}
+	token := -1
+	// recoveredAt is the number of tokens left when
+	// the parser last recovered from an error
+	recoveredAt := -1
+	next := func() bool {
+		if len(input) == 0 {
+			// the last token was shifted
+			return false
+		}
+		token, input = input[0], input[1:]
+		return true
+	}
+	for {
+		state := stack[len(stack)-1]
+		n := int(yyPact[state])
+		if n > yyFlag {
+			if token < 0 && !next() {
+				return true
+			}
+			if n += token; n >= 0 && n < yyLast && int(yyChk[yyAct[n]]) == token {
+				stack = append(stack, int(yyAct[n]))
+				token = -1
+				continue
+			}
+		}
+
+		n = int(yyDef[state])
+		if n == -2 {
+			if token < 0 && !next() {
+				return true
+			}
+			xi := 0
+			for yyExca[xi] != -1 || int(yyExca[xi+1]) != state {
+				xi += 2
+			}
+			for xi += 2; yyExca[xi] >= 0 && int(yyExca[xi]) != token; xi += 2 {
+			}
+			n = int(yyExca[xi+1])
+			if n < 0 {
+				// the end of the query is accepted
+				return true
+			}
+		}
+
+		if n == 0 {
+			if len(input) == 0 {
+				// the error is at the last token
+				return false
+			}
+			if recoveredAt == len(input) {
+				// the token failed again after the error, skip it
+				token = -1
+				continue
+			}
+			// pop the states up to one shifting the error token,
+			// the error rules then go on with the token
+			recoveredAt = len(input)
+			for {
+				if len(stack) == 0 {
+					return false
+				}
+				n = int(yyPact[stack[len(stack)-1]]) + yyErrCode
+				if n >= 0 && n < yyLast && int(yyChk[yyAct[n]]) == yyErrCode {
+					stack = append(stack, int(yyAct[n]))
+					break
+				}
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		// reduce by rule n, then go to the state following its symbol
+		stack = stack[:len(stack)-int(yyR2[n])]
+		n = int(yyR1[n])
+		g := int(yyPgo[n])
+		goTo := int(yyAct[g])
+		if j := g + stack[len(stack)-1] + 1; j < yyLast && int(yyChk[yyAct[j]]) == -n {
+			goTo = int(yyAct[j])
+		}
+		stack = append(stack, goTo)
+	}
+}
+
+// tokenLexer returns a single token
+type tokenLexer int
+
+func (l tokenLexer) Lex(*yySymType) int {
+	return int(l)
+}
+
+func (l tokenLexer) Error(string) {}
+
+// parserToken returns the number the parser
+// tables use for a token returned by the lexer
+func parserToken(char int) int {
+	_, token := yylex1(tokenLexer(char), &yySymType{})
+	return token
+}
@@ -0,0 +1,298 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		options QueryStringOptions
+		result  ParseError
+	}{
+		{
+			input:   `f:[1 2`,
+			options: DefaultOptions(),
+			result: ParseError{Offset: 5, Line: 1, Column: 6, Token: "2", Expected: []string{"TO"},
+				Msg: "syntax error: unexpected number, expecting TO"},
+		},
+		{
+			input:   `f:[1 TO 2`,
+			options: DefaultOptions(),
+			result: ParseError{Offset: 9, Line: 1, Column: 10, Token: "", Expected: []string{"]", "}"},
+				Msg: "syntax error: unexpected end of query, expecting ] or }"},
+		},
+		{
+			input:   "name:marty \nAND && b",
+			options: DefaultOptions(),
+			result: ParseError{Offset: 16, Line: 2, Column: 5, Token: "&&",
+				Expected: []string{"term", "phrase", "+", "-", "number", ">", "<", "(", "NOT", "[", "{", "function"},
+				Msg:      "syntax error: unexpected AND, expecting term, phrase, +, -, number, >, <, (, NOT, [, { or function"},
+		},
+		{
+			input:   `größe:>`,
+			options: DefaultOptions(),
+			result: ParseError{Offset: 9, Line: 1, Column: 8, Token: "",
+				Expected: []string{"term", "phrase", "-", "number", "=", "date"},
+				Msg:      "syntax error: unexpected end of query, expecting term, phrase, -, number, = or date"},
+		},
+		{
+			input:   `a "quick fox`,
+			options: DefaultOptions(),
+			result:  ParseError{Offset: 2, Line: 1, Column: 3, Token: `"quick fox`, Msg: "unterminated quote"},
+		},
+		{
+			input:   `a^2^3 b`,
+			options: DefaultOptions(),
+			result: ParseError{Offset: 1, Line: 1, Column: 2, Token: "^2^3",
+				Msg: `invalid boost value: strconv.ParseFloat: parsing "2^3": invalid syntax`},
+		},
+		{
+			input:   `marty~x`,
+			options: DefaultOptions(),
+			result: ParseError{Offset: 5, Line: 1, Column: 6, Token: "~x",
+				Msg: `invalid fuzziness value: strconv.ParseFloat: parsing "x": invalid syntax`},
+		},
+		{
+			input:   `a "quick fox"~-3`,
+			options: DefaultOptions(),
+			result:  ParseError{Offset: 13, Line: 1, Column: 14, Token: "~-3", Msg: "invalid slop value: -3 is negative"},
+		},
+		{
+			input:   `a created:>"2024-05-01"@Nowhere b`,
+			options: DefaultOptions(),
+			result: ParseError{Offset: 10, Line: 1, Column: 11, Token: `>"2024-05-01"@Nowhere`,
+				Msg: "invalid time: unknown time zone: Nowhere"},
+		},
+		{
+			input:   `loc:near(1,2)`,
+			options: DefaultOptions(),
+			result: ParseError{Offset: 4, Line: 1, Column: 5, Token: `near(1,2)`,
+				Msg: "near expects latitude, longitude and distance, got 2 arguments"},
+		},
+		{
+			input:   `a name:ma*`,
+			options: DefaultOptions().WithMinPrefixLength(3),
+			result: ParseError{Offset: 2, Line: 1, Column: 3, Token: `name:ma*`,
+				Msg: "prefix ma* is shorter than 3 characters"},
+		},
+		{
+			input:   `*`,
+			options: DefaultOptions().WithMinPrefixLength(3),
+			result:  ParseError{Offset: 0, Line: 1, Column: 1, Token: `*`, Msg: "prefix * is shorter than 3 characters"},
+		},
+		{
+			input:   `a name:*`,
+			options: DefaultOptions().WithMinPrefixLength(2),
+			result: ParseError{Offset: 2, Line: 1, Column: 3, Token: `name:*`,
+				Msg: "prefix * is shorter than 2 characters"},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := ParseQueryString(test.input, test.options)
+		var errs ParseErrors
+		if !errors.As(err, &errs) {
+			t.Errorf("expected parse errors, got %v for %s", err, test.input)
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("expected one error, got %d for %s", len(errs), test.input)
+			continue
+		}
+		errs[0].end, errs[0].unexpected = 0, 0
+		if !reflect.DeepEqual(*errs[0], test.result) {
+			t.Errorf("expected %#v, got %#v for %s", test.result, *errs[0], test.input)
+		}
+		if expected := test.result.Error(); err.Error() != expected {
+			t.Errorf("expected %s, got %s for %s", expected, err, test.input)
+		}
+	}
+}
+
+func TestParseErrorsLexer(t *testing.T) {
+	type result struct {
+		offset int
+		token  string
+		msg    string
+	}
+	tests := []struct {
+		input  string
+		result []result
+	}{
+		{
+			input:  `created:>"2024-05-01"@ b`,
+			result: []result{{offset: 21, token: "@", msg: "missing time zone"}},
+		},
+		{
+			input:  `loc:near(1,2`,
+			result: []result{{offset: 4, token: "near(1,2", msg: "unterminated argument list"}},
+		},
+		{
+			input:  `loc:polygon((0 0`,
+			result: []result{{offset: 4, token: "polygon((0 0", msg: "unterminated coordinates"}},
+		},
+		{
+			// lexing goes on after the error, finding more
+			input: `(a "b`,
+			result: []result{
+				{offset: 0, token: "(", msg: "unclosed paren"},
+				{offset: 3, token: `"b`, msg: "unterminated quote"},
+			},
+		},
+		{
+			input: `loc:polygon((0 0),(1 (1 1)),(0 0))`,
+			result: []result{
+				{offset: 4, token: "polygon((0 0),(1 (1 1))",
+					msg: "polygon expects (lat lon) coordinates, got: (1 (1 1)"},
+				{offset: 21, token: "(", msg: "coordinates cannot be nested"},
+				{offset: 32, token: ")", msg: "syntax error: unexpected ), expecting end of query, term, phrase, " +
+					"+, -, boost, number, >, <, (, AND, OR, NOT, [, { or function"},
+				{offset: 33, token: ")", msg: "syntax error: unexpected ), expecting end of query, term, phrase, " +
+					"+, -, number, >, <, (, NOT, [, { or function"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := ParseQueryString(test.input, DefaultOptions())
+		var errs ParseErrors
+		if !errors.As(err, &errs) {
+			t.Errorf("expected parse errors, got %v for %s", err, test.input)
+			continue
+		}
+		var actual []result
+		for _, e := range errs {
+			actual = append(actual, result{offset: e.Offset, token: e.Token, msg: e.Msg})
+		}
+		if !reflect.DeepEqual(actual, test.result) {
+			t.Errorf("expected %v, got %v for %s", test.result, actual, test.input)
+		}
+	}
+}
+
+func TestParseErrorsRecovery(t *testing.T) {
+	tests := []struct {
+		input   string
+		offsets []int
+		partial string
+		ast     string
+	}{
+		{
+			input:   `a:: b c^x d~y e:[1 TO ] f`,
+			offsets: []int{2, 7, 11, 22},
+			partial: `b c f`,
+			ast:     `b c d~y f`,
+		},
+		{
+			input:   `name:(a b:) c`,
+			offsets: []int{10},
+			partial: `(name:a) c`,
+			ast:     `name:(a) c`,
+		},
+		{
+			input:   `a) b`,
+			offsets: []int{1},
+			partial: `a b`,
+			ast:     `a b`,
+		},
+		{
+			input:   `created:>"bogus"@Nowhere x:>2024-13-45 good`,
+			offsets: []int{8, 27},
+			partial: `good`,
+			ast:     `created:>"bogus"@Nowhere x:>2024-13-45 good`,
+		},
+		{
+			input:   `(a "b`,
+			offsets: []int{0, 3},
+			partial: `(a "b")`,
+			ast:     `(a "b")`,
+		},
+		{
+			input:   `a name:ma* b`,
+			offsets: []int{2},
+			partial: `a b`,
+			ast:     `a name:ma* b`,
+		},
+		{
+			input:   `+ -`,
+			offsets: []int{2, 3},
+			partial: ``,
+			ast:     ``,
+		},
+		{
+			input:   `a:: b:: c::`,
+			offsets: []int{2, 6, 10},
+			partial: ``,
+			ast:     ``,
+		},
+		{
+			input:   `a) b) c)`,
+			offsets: []int{1, 4, 7},
+			partial: `a b c`,
+			ast:     `a b c`,
+		},
+		{
+			input:   `a AND AND b OR OR c`,
+			offsets: []int{6, 15},
+			partial: `c`,
+			ast:     `c`,
+		},
+	}
+
+	options := DefaultOptions().WithMinPrefixLength(3)
+	for _, test := range tests {
+		// without partial results only the errors are returned
+		q, err := ParseQueryString(test.input, options)
+		var errs ParseErrors
+		if !errors.As(err, &errs) {
+			t.Errorf("expected parse errors, got %v for %s", err, test.input)
+			continue
+		}
+		if q != nil {
+			t.Errorf("expected no query, got %#v for %s", q, test.input)
+		}
+		var offsets []int
+		for _, e := range errs {
+			offsets = append(offsets, e.Offset)
+		}
+		if !reflect.DeepEqual(offsets, test.offsets) {
+			t.Errorf("expected errors at %v, got %v for %s", test.offsets, offsets, test.input)
+		}
+
+		q, err = ParseQueryString(test.input, options.WithPartialResults(true))
+		if !errors.As(err, &errs) || len(errs) != len(test.offsets) {
+			t.Errorf("expected %d parse errors, got %v for %s", len(test.offsets), err, test.input)
+			continue
+		}
+		partial, err := FormatQuery(q, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if partial != test.partial {
+			t.Errorf("expected partial query %s, got %s for %s", test.partial, partial, test.input)
+		}
+
+		// values checked when compiling, such as prefixes, stay in the tree
+		ast, _ := ParseAST(test.input, options.WithPartialResults(true))
+		if actual := FormatAST(ast, options); actual != test.ast {
+			t.Errorf("expected tree %s, got %s for %s", test.ast, actual, test.input)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/searcher"
+	"github.com/blugelabs/bluge/search/similarity"
+)
+
+// existsField is the pseudo field name used to
+// search for documents having a value in a field
+const existsField = "_exists_"
+
+// ExistsQuery finds the documents having a value in a field.  The
+// index keeps no record of which fields a document has, so the query
+// searches for every term in the dictionary of the field, its cost
+// grows with the number of distinct terms of the field.
+type ExistsQuery struct {
+	field string
+	boost *float64
+}
+
+// NewExistsQuery creates a new Query which finds
+// documents having at least one term in the
+// specified field.  All matching documents
+// receive the same score, the boost.
+func NewExistsQuery(field string) *ExistsQuery {
+	return &ExistsQuery{
+		field: field,
+	}
+}
+
+func (q *ExistsQuery) SetBoost(b float64) *ExistsQuery {
+	q.boost = &b
+	return q
+}
+
+func (q *ExistsQuery) Boost() float64 {
+	if q.boost == nil {
+		return noBoost
+	}
+	return *q.boost
+}
+
+func (q *ExistsQuery) Field() string {
+	return q.field
+}
+
+func (q *ExistsQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	field := q.field
+	if q.field == "" {
+		field = options.DefaultSearchField
+	}
+	// walk the whole dictionary of the field, no automaton is needed, the
+	// constant scorer scores a document the same however many terms match
+	return searcher.NewTermRangeSearcher(i, nil, nil, true, true, field,
+		q.Boost(), similarity.ConstantScorer(q.Boost()), similarity.ConstantScorer(q.Boost()), options)
+}
@@ -0,0 +1,149 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/blugelabs/bluge"
+)
+
+func TestExistsQuerySearch(t *testing.T) {
+	writer, err := bluge.OpenWriter(bluge.InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	docs := []*bluge.Document{
+		bluge.NewDocument("a").
+			AddField(bluge.NewTextField("email", "marty@example.com")).
+			AddField(bluge.NewNumericField("age", 30)),
+		bluge.NewDocument("b").
+			AddField(bluge.NewTextField("name", "steve")),
+		bluge.NewDocument("c").
+			AddField(bluge.NewTextField("email", "steve@example.com")),
+	}
+	for _, doc := range docs {
+		if err = writer.Update(doc.ID(), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	tests := []struct {
+		input string
+		ids   []string
+	}{
+		{input: `_exists_:email`, ids: []string{"a", "c"}},
+		{input: `_exists_:age`, ids: []string{"a"}},
+		{input: `-_exists_:email`, ids: []string{"b"}},
+		{input: `NOT _exists_:age`, ids: []string{"b", "c"}},
+		{input: `_exists_:missing`, ids: nil},
+	}
+
+	for _, test := range tests {
+		q, err := ParseQueryString(test.input, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dmi, err := reader.Search(context.Background(), bluge.NewAllMatches(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == "_id" {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("expected %v, got %v for %s", test.ids, ids, test.input)
+		}
+	}
+}
+
+func TestExistsQueryScore(t *testing.T) {
+	writer, err := bluge.OpenWriter(bluge.InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	docs := []*bluge.Document{
+		bluge.NewDocument("a").
+			AddField(bluge.NewTextField("tags", "one")),
+		bluge.NewDocument("b").
+			AddField(bluge.NewTextField("tags", "one two three four five")),
+	}
+	for _, doc := range docs {
+		if err = writer.Update(doc.ID(), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	q := NewExistsQuery("tags").SetBoost(2)
+	dmi, err := reader.Search(context.Background(), bluge.NewAllMatches(q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		count++
+		if next.Score != 2 {
+			t.Errorf("expected score 2, got %f", next.Score)
+		}
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(docs) {
+		t.Errorf("expected %d matches, got %d", len(docs), count)
+	}
+}
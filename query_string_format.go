@@ -0,0 +1,630 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blugelabs/bluge"
+)
+
+// FormatAST renders a syntax tree as query string text, parsing
+// the text with the same options gives an equivalent tree.  Dates
+// are written as they were parsed, dates without their text are
+// formatted with the first date format of their field.
+func FormatAST(n Node, options QueryStringOptions) string {
+	f := &formatter{options: options}
+	if g, ok := n.(*Group); ok && g.Prefix == NoPrefix && g.Field == "" && g.Boost == nil {
+		// the root group needs no parentheses
+		f.clauses(g.Clauses)
+	} else {
+		f.clause(n)
+	}
+	return f.buf.String()
+}
+
+// FormatQuery renders a query as query string text, parsing the
+// text with the same options gives an equivalent query.  Queries
+// which the query string syntax cannot express return an error.
+func FormatQuery(q bluge.Query, options QueryStringOptions) (string, error) {
+	if _, ok := q.(*bluge.MatchNoneQuery); ok {
+		// the empty query
+		return "", nil
+	}
+	n, err := queryNode(q, options)
+	if err != nil {
+		return "", err
+	}
+	root, ok := n.(*Group)
+	if !ok {
+		root = &Group{Clauses: []Node{n}}
+	}
+	return FormatAST(root, options), nil
+}
+
+// queryNode returns the syntax tree of a query
+func queryNode(q bluge.Query, options QueryStringOptions) (Node, error) {
+	var n Node
+	var boost float64
+	switch v := q.(type) {
+	case *bluge.BooleanQuery:
+		n = numberNode(v)
+		if n == nil {
+			g, err := booleanNode(v, options)
+			if err != nil {
+				return nil, err
+			}
+			n = g
+		}
+		boost = v.Boost()
+	case *bluge.MatchQuery:
+		if v.Analyzer() != nil {
+			return nil, fmt.Errorf("cannot format a match query with an analyzer")
+		} else if v.Operator() != bluge.MatchQueryOperatorOr {
+			return nil, fmt.Errorf("cannot format a match query with the AND operator")
+		} else if v.Prefix() != 0 {
+			return nil, fmt.Errorf("cannot format a match query with a fuzzy prefix")
+		}
+		_, numErr := strconv.ParseFloat(v.Match(), 64)
+		if v.Fuzziness() != 0 && (numErr == nil || v.Match() == "") {
+			// quoted the term would be a phrase
+			return nil, fmt.Errorf("cannot format a fuzzy match query for %q", v.Match())
+		} else if v.Fuzziness() != 0 {
+			n = &Fuzzy{NodeBase: NodeBase{Field: v.Field()}, Term: v.Match(), Fuzziness: v.Fuzziness()}
+		} else if v.Field() == existsField {
+			return nil, fmt.Errorf("cannot format a match query in the %s field", existsField)
+		} else if _, ok := queryStringStringToken(v.Match()).(*Term); !ok {
+			// even escaped the term would be read as a wildcard or regexp
+			return nil, fmt.Errorf("cannot format a match query for %q", v.Match())
+		} else if f := (&formatter{options: options}); !f.plainTerm(v.Match()) {
+			// quoted the term would be a phrase
+			return nil, fmt.Errorf("cannot format a match query for %q", v.Match())
+		} else {
+			n = &Term{NodeBase: NodeBase{Field: v.Field()}, Term: v.Match()}
+		}
+		boost = v.Boost()
+	case *bluge.MatchPhraseQuery:
+		if v.Analyzer() != nil {
+			return nil, fmt.Errorf("cannot format a match phrase query with an analyzer")
+		} else if v.Slop() < 0 {
+			return nil, fmt.Errorf("cannot format a match phrase query with a negative slop")
+		}
+		n, boost = &Phrase{NodeBase: NodeBase{Field: v.Field()}, Phrase: v.Phrase(), Slop: v.Slop()}, v.Boost()
+	case *bluge.WildcardQuery:
+		if v.Field() == existsField {
+			return nil, fmt.Errorf("cannot format a wildcard query in the %s field", existsField)
+		}
+		n, boost = &Wildcard{NodeBase: NodeBase{Field: v.Field()}, Pattern: v.Wildcard()}, v.Boost()
+	case *bluge.PrefixQuery:
+		if v.Prefix() == "" || strings.ContainsAny(v.Prefix(), "*?") {
+			return nil, fmt.Errorf("cannot format prefix query for prefix %q", v.Prefix())
+		} else if v.Field() == existsField {
+			return nil, fmt.Errorf("cannot format a prefix query in the %s field", existsField)
+		}
+		n, boost = &Wildcard{NodeBase: NodeBase{Field: v.Field()}, Pattern: v.Prefix() + "*"}, v.Boost()
+	case *bluge.RegexpQuery:
+		n, boost = &Regexp{NodeBase: NodeBase{Field: v.Field()}, Pattern: v.Regexp()}, v.Boost()
+	case *bluge.NumericRangeQuery:
+		r := &NumericRange{NodeBase: NodeBase{Field: v.Field()}}
+		var min, max float64
+		min, r.MinInclusive = v.Min()
+		max, r.MaxInclusive = v.Max()
+		if min != bluge.MinNumeric {
+			r.Min = &min
+		}
+		if max != bluge.MaxNumeric {
+			r.Max = &max
+		}
+		n, boost = r, v.Boost()
+	case *bluge.DateRangeQuery:
+		r := &DateRange{NodeBase: NodeBase{Field: v.Field()}}
+		r.Min.Time, r.MinInclusive = v.Start()
+		r.Max.Time, r.MaxInclusive = v.End()
+		n, boost = r, v.Boost()
+	case *bluge.TermRangeQuery:
+		r := &TermRange{NodeBase: NodeBase{Field: v.Field()}}
+		r.Min, r.MinInclusive = v.Min()
+		r.Max, r.MaxInclusive = v.Max()
+		f := &formatter{options: options, fields: []string{v.Field()}}
+		if r.Min == "" && r.Max == "" {
+			return nil, fmt.Errorf("cannot format a term range without bounds")
+		} else if f.readAsDate(r.Min) && f.readAsDate(r.Max) {
+			return nil, fmt.Errorf("cannot format a term range of dates %q to %q", r.Min, r.Max)
+		}
+		n, boost = r, v.Boost()
+	case *ExistsQuery:
+		if v.Field() == "" {
+			return nil, fmt.Errorf("cannot format an exists query without a field")
+		}
+		n, boost = &Term{NodeBase: NodeBase{Field: existsField}, Term: v.Field()}, v.Boost()
+	case *bluge.GeoDistanceQuery:
+		location := v.Location()
+		n = &GeoDistance{
+			NodeBase: NodeBase{Field: v.Field()},
+			Lon:      location[0],
+			Lat:      location[1],
+			Distance: v.Distance(),
+		}
+		boost = v.Boost()
+	case *bluge.GeoBoundingBoxQuery:
+		topLeft, bottomRight := v.TopLeft(), v.BottomRight()
+		n = &GeoBoundingBox{
+			NodeBase:       NodeBase{Field: v.Field()},
+			TopLeftLon:     topLeft[0],
+			TopLeftLat:     topLeft[1],
+			BottomRightLon: bottomRight[0],
+			BottomRightLat: bottomRight[1],
+		}
+		boost = v.Boost()
+	case *bluge.GeoBoundingPolygonQuery:
+		if len(v.Points()) < 3 {
+			return nil, fmt.Errorf("cannot format a polygon of %d points", len(v.Points()))
+		}
+		n, boost = &GeoPolygon{NodeBase: NodeBase{Field: v.Field()}, Points: v.Points()}, v.Boost()
+	default:
+		return nil, fmt.Errorf("cannot format %T as a query string", q)
+	}
+	if boost != noBoost {
+		n.base().Boost = &boost
+	}
+	return n, nil
+}
+
+// numberNode returns the node of a number searched as term and as
+// numeric value, which is a boolean query of the two, or else nil
+func numberNode(q *bluge.BooleanQuery) Node {
+	if len(q.Shoulds()) != 2 || len(q.Musts()) != 0 || len(q.MustNots()) != 0 || q.MinShould() != 0 {
+		return nil
+	}
+	match, ok := q.Shoulds()[0].(*bluge.MatchQuery)
+	if !ok || match.Fuzziness() != 0 || match.Analyzer() != nil || match.Boost() != noBoost {
+		return nil
+	}
+	numeric, ok := q.Shoulds()[1].(*bluge.NumericRangeQuery)
+	if !ok || numeric.Field() != match.Field() || numeric.Boost() != noBoost {
+		return nil
+	}
+	value, err := strconv.ParseFloat(match.Match(), 64)
+	if err != nil {
+		return nil
+	}
+	min, minInclusive := numeric.Min()
+	max, maxInclusive := numeric.Max()
+	if min != value || max != value || !minInclusive || !maxInclusive {
+		return nil
+	}
+	return &Number{NodeBase: NodeBase{Field: match.Field()}, Text: match.Match(), Value: value}
+}
+
+// booleanNode returns the group of a boolean query, which joins
+// its clauses with prefixes, or the OR of its clauses for the AND operator
+func booleanNode(q *bluge.BooleanQuery, options QueryStringOptions) (Node, error) {
+	if q.MinShould() != 0 {
+		return nil, fmt.Errorf("cannot format a boolean query with minimum should match")
+	}
+	if len(q.Musts())+len(q.Shoulds())+len(q.MustNots()) == 0 {
+		return nil, fmt.Errorf("cannot format a boolean query without clauses")
+	}
+
+	g := &Group{}
+	add := func(queries []bluge.Query, prefix Prefix) error {
+		for _, clause := range queries {
+			n, err := queryNode(clause, options)
+			if err != nil {
+				return err
+			}
+			n.base().Prefix = prefix
+			g.Clauses = append(g.Clauses, n)
+		}
+		return nil
+	}
+	if options.defaultOperator == AndOperator {
+		// clauses without a prefix are required
+		if err := add(q.Musts(), NoPrefix); err != nil {
+			return nil, err
+		}
+	} else if err := add(q.Musts(), MustPrefix); err != nil {
+		return nil, err
+	}
+	if options.defaultOperator == AndOperator && len(q.Shoulds()) > 0 {
+		// optional clauses must be the only clauses of the group
+		if len(g.Clauses) > 0 || len(q.MustNots()) > 0 {
+			return nil, fmt.Errorf("cannot format a boolean query with should and must " +
+				"clauses for the AND operator")
+		}
+		or := &Or{}
+		for _, clause := range q.Shoulds() {
+			n, err := queryNode(clause, options)
+			if err != nil {
+				return nil, err
+			}
+			or.Clauses = append(or.Clauses, n)
+		}
+		return or, nil
+	}
+	if err := add(q.Shoulds(), NoPrefix); err != nil {
+		return nil, err
+	}
+	if err := add(q.MustNots(), MustNotPrefix); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+type formatter struct {
+	buf     strings.Builder
+	options QueryStringOptions
+	fields  []string
+}
+
+func (f *formatter) clauses(nodes []Node) {
+	for i, n := range nodes {
+		if i > 0 {
+			f.buf.WriteByte(' ')
+		}
+		f.clause(n)
+	}
+}
+
+// clause writes a node with its prefix, field and boost
+func (f *formatter) clause(n Node) {
+	base := n.base()
+	switch base.Prefix {
+	case MustPrefix:
+		f.buf.WriteByte('+')
+	case MustNotPrefix:
+		f.buf.WriteByte('-')
+	}
+	if base.Field != "" {
+		f.buf.WriteString(escapeTerm(base.Field))
+		f.buf.WriteByte(':')
+		f.fields = append(f.fields, base.Field)
+		defer func() {
+			f.fields = f.fields[:len(f.fields)-1]
+		}()
+	}
+	if operatorPrecedence(n) < clausePrecedence &&
+		(base.Prefix != NoPrefix || base.Field != "" || base.Boost != nil) {
+		// only a group gives an operator a prefix, field or boost
+		f.buf.WriteByte('(')
+		f.value(n)
+		f.buf.WriteByte(')')
+	} else {
+		f.value(n)
+	}
+	if base.Boost != nil {
+		f.buf.WriteByte('^')
+		f.buf.WriteString(formatFloat(*base.Boost))
+	}
+}
+
+// operand writes a clause of an operator, nested
+// operators of lower precedence are grouped
+func (f *formatter) operand(n Node, precedence int) {
+	if operatorPrecedence(n) < precedence {
+		f.buf.WriteByte('(')
+		f.clause(n)
+		f.buf.WriteByte(')')
+		return
+	}
+	f.clause(n)
+}
+
+const (
+	orPrecedence = iota
+	andPrecedence
+	notPrecedence
+	clausePrecedence
+)
+
+func operatorPrecedence(n Node) int {
+	switch n.(type) {
+	case *Or:
+		return orPrecedence
+	case *And:
+		return andPrecedence
+	case *Not:
+		return notPrecedence
+	}
+	return clausePrecedence
+}
+
+func (f *formatter) operator(keyword, symbol string) string {
+	if f.options.keywordOperators {
+		return keyword
+	}
+	return symbol
+}
+
+func (f *formatter) value(n Node) {
+	switch v := n.(type) {
+	case *Bad:
+		// as written, the text won't parse either
+		f.buf.WriteString(v.Text)
+	case *Group:
+		f.buf.WriteByte('(')
+		f.clauses(v.Clauses)
+		f.buf.WriteByte(')')
+	case *Or:
+		for i, c := range v.Clauses {
+			if i > 0 {
+				f.buf.WriteString(" " + f.operator("OR", "||") + " ")
+			}
+			f.operand(c, orPrecedence)
+		}
+	case *And:
+		for i, c := range v.Clauses {
+			if i > 0 {
+				f.buf.WriteString(" " + f.operator("AND", "&&") + " ")
+			}
+			f.operand(c, andPrecedence)
+		}
+	case *Not:
+		f.buf.WriteString(f.operator("NOT ", "!"))
+		f.operand(v.Clause, notPrecedence)
+	case *Term:
+		f.term(v.Term)
+	case *Fuzzy:
+		if _, err := strconv.ParseFloat(v.Term, 64); err == nil || v.Term == "" {
+			f.phrase(v.Term)
+		} else {
+			// keywords and function names followed by a tilde are terms
+			f.buf.WriteString(escapeTerm(v.Term))
+		}
+		f.buf.WriteByte('~')
+		f.buf.WriteString(strconv.Itoa(v.Fuzziness))
+	case *Number:
+		text := v.Text
+		if text == "" {
+			text = formatFloat(v.Value)
+		}
+		if strings.HasPrefix(text, "-") && len(f.fields) == 0 {
+			// a leading - would be a prefix
+			text = `\` + text
+		}
+		f.buf.WriteString(text)
+	case *Phrase:
+		f.phrase(v.Phrase)
+		if v.Slop != 0 {
+			f.buf.WriteByte('~')
+			f.buf.WriteString(strconv.Itoa(v.Slop))
+		}
+	case *Wildcard:
+		f.buf.WriteString(escape(v.Pattern, "*?"))
+	case *Regexp:
+		f.buf.WriteByte('/')
+		f.buf.WriteString(escapeRegexp(v.Pattern))
+		f.buf.WriteByte('/')
+	case *NumericRange:
+		var min, max string
+		if v.Min != nil {
+			min = formatFloat(*v.Min)
+		}
+		if v.Max != nil {
+			max = formatFloat(*v.Max)
+		}
+		f.rangeValue(min, max, v.MinInclusive, v.MaxInclusive)
+	case *DateRange:
+		f.rangeValue(f.dateBound(v.Min), f.dateBound(v.Max), v.MinInclusive, v.MaxInclusive)
+	case *TermRange:
+		f.rangeValue(f.termBound(v.Min), f.termBound(v.Max), v.MinInclusive, v.MaxInclusive)
+	case *GeoDistance:
+		f.buf.WriteString("near(" + formatFloat(v.Lat) + "," + formatFloat(v.Lon) + "," + v.Distance + ")")
+	case *GeoBoundingBox:
+		f.buf.WriteString("bbox(" + formatFloat(v.TopLeftLat) + "," + formatFloat(v.TopLeftLon) + "," +
+			formatFloat(v.BottomRightLat) + "," + formatFloat(v.BottomRightLon) + ")")
+	case *GeoPolygon:
+		f.buf.WriteString("polygon(")
+		// close the polygon by repeating the first point
+		for i, p := range append(v.Points, v.Points[0]) {
+			if i > 0 {
+				f.buf.WriteByte(',')
+			}
+			f.buf.WriteString("(" + formatFloat(p.Lat) + " " + formatFloat(p.Lon) + ")")
+		}
+		f.buf.WriteByte(')')
+	}
+}
+
+// term writes a term, terms which would be read as
+// something else even when escaped are quoted instead
+func (f *formatter) term(term string) {
+	if !f.plainTerm(term) {
+		f.phrase(term)
+		return
+	}
+	f.buf.WriteString(escapeTerm(term))
+}
+
+func (f *formatter) plainTerm(term string) bool {
+	if term == "" {
+		return false
+	}
+	if f.options.keywordOperators && (term == "AND" || term == "OR" || term == "NOT") {
+		return false
+	}
+	if _, err := strconv.ParseFloat(term, 64); err == nil {
+		return false
+	}
+	return !functionNames[term]
+}
+
+func (f *formatter) phrase(phrase string) {
+	f.buf.WriteByte('"')
+	f.buf.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(phrase))
+	f.buf.WriteByte('"')
+}
+
+// rangeValue writes a range, using > or < when one end is open,
+// the bounds are already formatted with * for an open end
+func (f *formatter) rangeValue(min, max string, minInclusive, maxInclusive bool) {
+	if min == "" {
+		min = "*"
+	}
+	if max == "" {
+		max = "*"
+	}
+	switch {
+	case min != "*" && max == "*":
+		f.buf.WriteByte('>')
+		if minInclusive {
+			f.buf.WriteByte('=')
+		}
+		f.buf.WriteString(min)
+	case min == "*" && max != "*":
+		f.buf.WriteByte('<')
+		if maxInclusive {
+			f.buf.WriteByte('=')
+		}
+		f.buf.WriteString(max)
+	default:
+		if minInclusive {
+			f.buf.WriteByte('[')
+		} else {
+			f.buf.WriteByte('{')
+		}
+		f.buf.WriteString(min + " TO " + max)
+		if maxInclusive {
+			f.buf.WriteByte(']')
+		} else {
+			f.buf.WriteByte('}')
+		}
+	}
+}
+
+// dateBound formats one end of a date range as a phrase
+func (f *formatter) dateBound(b DateBound) string {
+	value := b.Value
+	if value == "" {
+		if b.Time.IsZero() {
+			return ""
+		}
+		value = formatTime(f.dateFormat(), b.Time)
+	}
+	rv := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	if b.Zone != "" {
+		rv += "@" + b.Zone
+	}
+	return rv
+}
+
+// dateFormats returns the date formats of the current field
+func (f *formatter) dateFormats() []string {
+	if len(f.fields) > 0 {
+		if fieldFormats, ok := f.options.fieldDateFormats[f.fields[len(f.fields)-1]]; ok {
+			return fieldFormats
+		}
+	}
+	return f.options.dateFormats
+}
+
+// parseDate parses a date with the date formats of the current field
+func (f *formatter) parseDate(str string) (time.Time, error) {
+	return parseTimeFormats(f.dateFormats(), str, time.UTC)
+}
+
+// dateFormat returns the first date format of the current field
+func (f *formatter) dateFormat() string {
+	formats := f.dateFormats()
+	if len(formats) == 0 {
+		return time.RFC3339
+	}
+	return formats[0]
+}
+
+func formatTime(format string, t time.Time) string {
+	switch format {
+	case EpochSeconds:
+		return strconv.FormatInt(t.Unix(), 10)
+	case EpochMillis:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	case time.RFC3339:
+		// parsing RFC3339 accepts fractional seconds
+		format = time.RFC3339Nano
+	}
+	return t.Format(format)
+}
+
+// termBound formats one end of a term range, bounds which would be
+// read as a number, a date, a keyword or an open end are quoted
+func (f *formatter) termBound(term string) string {
+	if term == "" {
+		return ""
+	} else if f.quotedBound(term) {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(term) + `"`
+	}
+	return escapeTerm(term)
+}
+
+func (f *formatter) quotedBound(term string) bool {
+	_, err := strconv.ParseFloat(term, 64)
+	return err == nil || term == "TO" || term == "*" || isoDateRegexp.MatchString(term) ||
+		isDateMath(term, f.parseDate)
+}
+
+// readAsDate reports whether a term range bound is read as
+// a date, a range with dates or open ends at both ends is
+// read as a date range rather than a term range
+func (f *formatter) readAsDate(term string) bool {
+	if term == "" {
+		return true
+	} else if !f.quotedBound(term) {
+		return false
+	} else if isDateMath(term, f.parseDate) {
+		_, err := parseDateMath(term, time.Now(), f.parseDate, false)
+		return err == nil
+	}
+	_, err := f.parseDate(term)
+	return err == nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// escapeTerm escapes all the reserved characters of a term
+func escapeTerm(term string) string {
+	return escape(term, "")
+}
+
+// escape escapes the reserved characters of str
+// with a backslash, except for those in keep
+func escape(str, keep string) string {
+	var sb strings.Builder
+	for _, r := range str {
+		if strings.ContainsRune(reservedChars, r) && !strings.ContainsRune(keep, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// escapeRegexp escapes the slashes of a regexp which aren't escaped yet
+func escapeRegexp(pattern string) string {
+	var sb strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		if r == '/' && !escaped {
+			sb.WriteByte('\\')
+		}
+		escaped = !escaped && r == '\\'
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
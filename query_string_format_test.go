@@ -0,0 +1,343 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/numeric/geo"
+)
+
+func TestFormatAST(t *testing.T) {
+	theNow := time.Date(2024, 5, 15, 10, 30, 45, 0, time.UTC)
+	options := DefaultOptions().WithNow(func() time.Time { return theNow })
+
+	tests := []struct {
+		input  string
+		result string
+	}{
+		{input: `marty`, result: `marty`},
+		{input: `  +name:marty^2   -"quick fox"~3 `, result: `+name:marty^2 -"quick fox"~3`},
+		{input: `"say \"hi\"" a\:b c\ d`, result: `"say \"hi\"" a\:b c\ d`},
+		{input: `mart* ma?ty /ma.*y/ /a\/b/ marty~1`, result: `mart* ma?ty /ma.*y/ /a\/b/ marty~1`},
+		{input: `age:-5 5 3.14`, result: `age:-5 5 3.14`},
+		{input: `a && b || !c`, result: `a AND b OR NOT c`},
+		{input: `a AND (b OR c) NOT (d AND e)`, result: `a AND (b OR c) NOT (d AND e)`},
+		{input: `title:(a -b)^3`, result: `title:(a -b)^3`},
+		{input: `age:>=18 age:<5 price:{1 TO 5] price:[-1 TO 1}`, result: `age:>=18 age:<5 price:{1 TO 5] price:[-1 TO 1}`},
+		{input: `name:[a TO *] name:{"5" TO "a b"]`, result: `name:>=a name:{"5" TO a\ b]`},
+		{input: `created:>2024-05-01 created:[now-1d/d TO "now"@Europe/Berlin]`,
+			result: `created:>"2024-05-01" created:["now-1d/d" TO "now"@Europe/Berlin]`},
+		{input: `_exists_:email email:*`, result: `_exists_:email email:*`},
+		{input: `loc:near(1.5, 2, 3km) loc:bbox(2,0,0,2) loc:polygon((0 0),(0 1),(1 1),(0 0))`,
+			result: `loc:near(1.5,2,3km) loc:bbox(2,0,0,2) loc:polygon((0 0),(0 1),(1 1),(0 0))`},
+	}
+
+	for _, test := range tests {
+		ast, err := ParseAST(test.input, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := FormatAST(ast, options)
+		if result != test.result {
+			t.Errorf("expected %s, got %s for %s", test.result, result, test.input)
+			continue
+		}
+
+		// the formatted query parses to the same query, and formats the same
+		expected, err := ParseQueryString(test.input, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := ParseQueryString(result, options)
+		if err != nil {
+			t.Fatalf("unexpected error %v parsing %s", err, result)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected %#v, got %#v for %s", expected, actual, result)
+		}
+		reparsed, err := ParseAST(result, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again := FormatAST(reparsed, options); again != result {
+			t.Errorf("expected %s, got %s formatting again", result, again)
+		}
+	}
+}
+
+func TestFormatASTBuilt(t *testing.T) {
+	boost := 2.0
+	min := 5.0
+	theDate := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		node    Node
+		options QueryStringOptions
+		result  string
+	}{
+		{
+			node: &Group{Clauses: []Node{
+				&Term{NodeBase: NodeBase{Field: "tenant"}, Term: "acme"},
+				&Or{
+					NodeBase: NodeBase{Prefix: MustPrefix},
+					Clauses: []Node{
+						&Term{Term: "AND"},
+						&Term{Term: "42"},
+					},
+				},
+			}},
+			options: DefaultOptions(),
+			result:  `tenant:acme +("AND" OR "42")`,
+		},
+		{
+			node: &And{Clauses: []Node{
+				&Or{Clauses: []Node{&Term{Term: "a"}, &Term{Term: "b"}}},
+				&Not{Clause: &Term{Term: "c"}},
+			}},
+			options: DefaultOptions().WithKeywordOperators(false),
+			result:  `(a || b) && !c`,
+		},
+		{
+			node: &Group{
+				NodeBase: NodeBase{Field: "body", Boost: &boost},
+				Clauses:  []Node{&Number{Value: 1.5}, &Wildcard{Pattern: "a b*"}},
+			},
+			options: DefaultOptions(),
+			result:  `body:(1.5 a\ b*)^2`,
+		},
+		{
+			node: &Group{Clauses: []Node{
+				&DateRange{
+					NodeBase:     NodeBase{Field: "created"},
+					Min:          DateBound{Time: theDate},
+					MinInclusive: true,
+					MaxInclusive: true,
+				},
+				&DateRange{
+					NodeBase:     NodeBase{Field: "updated"},
+					Max:          DateBound{Time: theDate},
+					MinInclusive: true,
+				},
+				&NumericRange{
+					NodeBase:     NodeBase{Field: "age"},
+					Min:          &min,
+					MaxInclusive: true,
+				},
+			}},
+			options: DefaultOptions().WithFieldDateFormats(map[string][]string{"updated": {EpochMillis}}),
+			result:  `created:>="2024-05-01T12:00:00Z" updated:<"1714564800000" age:>5`,
+		},
+	}
+
+	for _, test := range tests {
+		result := FormatAST(test.node, test.options)
+		if result != test.result {
+			t.Errorf("expected %s, got %s", test.result, result)
+			continue
+		}
+		if _, err := ParseQueryString(result, test.options); err != nil {
+			t.Errorf("unexpected error %v parsing %s", err, result)
+		}
+	}
+}
+
+func TestFormatQuery(t *testing.T) {
+	theDate := time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.UTC)
+
+	tests := []struct {
+		query   bluge.Query
+		options QueryStringOptions
+		result  string
+	}{
+		{
+			query:   bluge.NewMatchNoneQuery(),
+			options: DefaultOptions(),
+			result:  ``,
+		},
+		{
+			query:   bluge.NewMatchQuery("marty").SetField("name").SetBoost(2),
+			options: DefaultOptions(),
+			result:  `name:marty^2`,
+		},
+		{
+			query: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("marty").SetFuzziness(2)).
+				AddShould(bluge.NewMatchPhraseQuery("quick fox").SetSlop(3).SetField("title")).
+				AddMustNot(bluge.NewWildcardQuery("ma?ty")),
+			options: DefaultOptions(),
+			result:  `+marty~2 title:"quick fox"~3 -ma?ty`,
+		},
+		{
+			query: bluge.NewBooleanQuery().
+				AddShould(bluge.NewPrefixQuery("mart").SetField("name")).
+				AddShould(bluge.NewRegexpQuery("a/b.*").SetBoost(0.5)).
+				AddShould(NewExistsQuery("email")),
+			options: DefaultOptions(),
+			result:  `name:mart* /a\/b.*/^0.5 _exists_:email`,
+		},
+		{
+			query: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(18, bluge.MaxNumeric, true, false).SetField("age")).
+				AddShould(bluge.NewNumericRangeInclusiveQuery(1, 5, false, true).SetField("price")).
+				AddShould(bluge.NewDateRangeInclusiveQuery(theDate, time.Time{}, true, false).SetField("created")).
+				AddShould(bluge.NewTermRangeInclusiveQuery("a", "m", true, false).SetField("name")),
+			options: DefaultOptions(),
+			result:  `age:>=18 price:{1 TO 5] created:>="2024-05-01T12:00:00.5Z" name:[a TO m}`,
+		},
+		{
+			query: bluge.NewBooleanQuery().
+				AddShould(bluge.NewGeoDistanceQuery(-122.41, 37.77, "5km").SetField("loc")).
+				AddShould(bluge.NewGeoBoundingBoxQuery(-122.45, 37.79, -122.39, 37.75).SetField("loc")).
+				AddShould(bluge.NewGeoBoundingPolygonQuery([]geo.Point{{Lon: 0, Lat: 0}, {Lon: 1, Lat: 0}, {Lon: 1, Lat: 1}}).SetField("loc")),
+			options: DefaultOptions(),
+			result: `loc:near(37.77,-122.41,5km) loc:bbox(37.79,-122.45,37.75,-122.39) ` +
+				`loc:polygon((0 0),(0 1),(1 1),(0 0))`,
+		},
+		{
+			query: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("5").SetField("age")).
+					AddShould(bluge.NewNumericRangeInclusiveQuery(5, 5, true, true).SetField("age")).
+					SetBoost(3)).
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("a")).
+					AddShould(bluge.NewMatchQuery("AND"))),
+			options: DefaultOptions().WithKeywordOperators(false),
+			result:  `+age:5^3 +(a AND)`,
+		},
+		{
+			query: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")),
+			options: DefaultOptions().WithDefaultOperator(AndOperator),
+			result:  `a OR b`,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := FormatQuery(test.query, test.options)
+		if err != nil {
+			t.Errorf("unexpected error %v formatting %#v", err, test.query)
+			continue
+		}
+		if result != test.result {
+			t.Errorf("expected %s, got %s", test.result, result)
+			continue
+		}
+		if _, err := ParseQueryString(result, test.options); err != nil {
+			t.Errorf("unexpected error %v parsing %s", err, result)
+		}
+	}
+}
+
+func TestFormatQueryRoundTrip(t *testing.T) {
+	theNow := time.Date(2024, 5, 15, 10, 30, 45, 0, time.UTC)
+	options := DefaultOptions().WithNow(func() time.Time { return theNow })
+
+	tests := []struct {
+		input   string
+		options QueryStringOptions
+	}{
+		{input: `+name:marty^2 -"quick fox"~3 marty~1`, options: options},
+		{input: `mart* ma?ty /ma.*y/ _exists_:email email:*`, options: options},
+		{input: `age:5 age:>=18 price:{1 TO 5] name:[a TO m}`, options: options},
+		{input: `title:(a -b)^3 (c d)`, options: options},
+		{input: `created:>2024-05-01 created:[now-1d/d TO now]`, options: options},
+		{input: `a AND b OR NOT c`, options: options},
+		{input: `loc:near(1.5, 2, 3km) loc:bbox(2,0,0,2) loc:polygon((0 0),(0 1),(1 1),(0 0))`, options: options},
+		{input: `a OR b`, options: options.WithDefaultOperator(AndOperator)},
+		{input: `a b -c`, options: options.WithDefaultOperator(AndOperator)},
+		{input: `name:{"5" TO a] name:["*" TO m] name:<"2024-05-01"`, options: options},
+		{input: `email:* url:/usr/bin a\*b~1`, options: options},
+		{input: `OR~2 f:NOT~1 near~1`, options: options},
+	}
+
+	for _, test := range tests {
+		expected, err := ParseQueryString(test.input, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := FormatQuery(expected, test.options)
+		if err != nil {
+			t.Errorf("unexpected error %v formatting %s", err, test.input)
+			continue
+		}
+		actual, err := ParseQueryString(result, test.options)
+		if err != nil {
+			t.Errorf("unexpected error %v parsing %s", err, result)
+			continue
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected %#v, got %#v for %s formatted as %s", expected, actual, test.input, result)
+		}
+	}
+}
+
+func TestFormatQueryInvalid(t *testing.T) {
+	tests := []struct {
+		query   bluge.Query
+		options QueryStringOptions
+	}{
+		{query: bluge.NewTermQuery("marty"), options: DefaultOptions()},
+		{query: bluge.NewMatchAllQuery(), options: DefaultOptions()},
+		{query: bluge.NewBooleanQuery(), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("a b").SetOperator(bluge.MatchQueryOperatorAnd), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("marty").SetFuzziness(1).SetPrefix(2), options: DefaultOptions()},
+		{query: bluge.NewPrefixQuery(""), options: DefaultOptions()},
+		{query: bluge.NewMatchPhraseQuery("a b").SetSlop(-2), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("a*b"), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("42"), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("AND"), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("near"), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery(""), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("42").SetFuzziness(1), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("/abc/"), options: DefaultOptions()},
+		{query: bluge.NewMatchQuery("email").SetField(existsField), options: DefaultOptions()},
+		{query: bluge.NewWildcardQuery("e*").SetField(existsField), options: DefaultOptions()},
+		{query: bluge.NewPrefixQuery("e").SetField(existsField), options: DefaultOptions()},
+		{query: bluge.NewTermRangeQuery("5", ""), options: DefaultOptions().WithDateFormats(EpochSeconds)},
+		{query: bluge.NewTermRangeQuery("2024-05-01", "2024-06-01"), options: DefaultOptions()},
+		{query: bluge.NewTermRangeQuery("now-1d", ""), options: DefaultOptions()},
+		{query: bluge.NewTermRangeQuery("", ""), options: DefaultOptions()},
+		{
+			query: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")).
+				SetMinShould(1),
+			options: DefaultOptions(),
+		},
+		{
+			query: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")),
+			options: DefaultOptions().WithDefaultOperator(AndOperator),
+		},
+		{
+			query:   bluge.NewBooleanQuery().AddMust(bluge.NewMatchQuery("a")).AddMust(bluge.NewTermQuery("b")),
+			options: DefaultOptions(),
+		},
+	}
+
+	for _, test := range tests {
+		result, err := FormatQuery(test.query, test.options)
+		if err == nil {
+			t.Errorf("expected error, got %s for %#v", result, test.query)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/blugelabs/bluge/numeric/geo"
+)
+
+const (
+	minLat = -90.0
+	maxLat = 90.0
+	minLon = -180.0
+	maxLon = 180.0
+)
+
+func queryStringFunction(fn functionCall) (Node, error) {
+	switch fn.name {
+	case "near":
+		return queryStringGeoDistance(fn.args)
+	case "bbox":
+		return queryStringGeoBoundingBox(fn.args)
+	case "polygon":
+		return queryStringGeoPolygon(fn.args)
+	}
+	return nil, fmt.Errorf("unknown function: %s", fn.name)
+}
+
+// queryStringGeoDistance builds the node for near(lat,lon,distance),
+// the distance is a number followed by a unit like m, km, mi or ft
+func queryStringGeoDistance(args []string) (*GeoDistance, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("near expects latitude, longitude and distance, got %d arguments", len(args))
+	}
+	lat, lon, err := queryStringGeoPoint(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	dist, err := geo.ParseDistance(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid distance: %s", args[2])
+	}
+	if dist <= 0 {
+		return nil, fmt.Errorf("distance must be positive: %s", args[2])
+	}
+	return &GeoDistance{Lat: lat, Lon: lon, Distance: args[2]}, nil
+}
+
+// queryStringGeoBoundingBox builds the node for
+// bbox(top_left_lat,top_left_lon,bottom_right_lat,bottom_right_lon)
+func queryStringGeoBoundingBox(args []string) (*GeoBoundingBox, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("bbox expects top left and bottom right latitude and longitude, got %d arguments", len(args))
+	}
+	topLeftLat, topLeftLon, err := queryStringGeoPoint(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	bottomRightLat, bottomRightLon, err := queryStringGeoPoint(args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	if topLeftLat < bottomRightLat {
+		return nil, fmt.Errorf("bbox top latitude %s is below bottom latitude %s", args[0], args[2])
+	}
+	return &GeoBoundingBox{
+		TopLeftLat:     topLeftLat,
+		TopLeftLon:     topLeftLon,
+		BottomRightLat: bottomRightLat,
+		BottomRightLon: bottomRightLon,
+	}, nil
+}
+
+// queryStringGeoPolygon builds the node for polygon((lat lon),(lat lon),...),
+// the polygon must be closed by repeating the first point at the end
+func queryStringGeoPolygon(args []string) (*GeoPolygon, error) {
+	points := make([]geo.Point, 0, len(args))
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "(") || !strings.HasSuffix(arg, ")") {
+			return nil, fmt.Errorf("polygon expects (lat lon) coordinates, got: %s", arg)
+		}
+		coords := strings.FieldsFunc(arg[1:len(arg)-1], func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+		if len(coords) != 2 {
+			return nil, fmt.Errorf("polygon expects (lat lon) coordinates, got: %s", arg)
+		}
+		lat, lon, err := queryStringGeoPoint(coords[0], coords[1])
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, geo.Point{Lon: lon, Lat: lat})
+	}
+	// a closed triangle has four points
+	if len(points) < 4 {
+		return nil, fmt.Errorf("polygon needs at least three distinct points, got %d points", len(points))
+	}
+	if points[0] != points[len(points)-1] {
+		return nil, fmt.Errorf("polygon is not closed, last point %s differs from first point %s", args[len(args)-1], args[0])
+	}
+	// the closing point repeats the first one
+	distinct := make(map[geo.Point]bool, len(points)-1)
+	for _, p := range points[:len(points)-1] {
+		distinct[p] = true
+	}
+	if len(distinct) < 3 {
+		return nil, fmt.Errorf("polygon needs at least three distinct points, got %d distinct points", len(distinct))
+	}
+	// the search closes the polygon itself
+	return &GeoPolygon{Points: points[:len(points)-1]}, nil
+}
+
+func queryStringGeoPoint(latStr, lonStr string) (lat, lon float64, err error) {
+	lat, err = strconv.ParseFloat(latStr, 64)
+	if err != nil || !(lat >= minLat && lat <= maxLat) {
+		return 0, 0, fmt.Errorf("invalid latitude: %s", latStr)
+	}
+	lon, err = strconv.ParseFloat(lonStr, 64)
+	if err != nil || !(lon >= minLon && lon <= maxLon) {
+		return 0, 0, fmt.Errorf("invalid longitude: %s", lonStr)
+	}
+	return lat, lon, nil
+}
@@ -0,0 +1,280 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blugelabs/bluge"
+)
+
+// Warning is a change lenient parsing made to a
+// query string so that it parses despite an error
+type Warning struct {
+	// Offset is the byte offset of the changed text in the query string
+	Offset int
+	// Line and Column are the position of the offset, both
+	// starting at 1, the column counts runes
+	Line, Column int
+	// Token is the changed text, it is empty
+	// at the end of the query string
+	Token string
+	// Msg describes the change
+	Msg string
+	// Err is the error the change works around
+	Err *ParseError
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%d:%d: %s", w.Line, w.Column, w.Msg)
+}
+
+// newWarning returns the warning of a change to the query
+// string text from byte offset start up to end
+func newWarning(query string, start, end int, msg string, err *ParseError) *Warning {
+	pos := newParseError(start, end, msg)
+	pos.locate(query)
+	err.locate(query)
+	return &Warning{
+		Offset: pos.Offset,
+		Line:   pos.Line,
+		Column: pos.Column,
+		Token:  pos.Token,
+		Msg:    msg,
+		Err:    err,
+	}
+}
+
+// lexerChanges are the changes the lexer
+// makes to go on after each of its errors
+var lexerChanges = map[string]string{
+	"unterminated quote":           "closed the quote",
+	"missing time zone":            "dropped the @",
+	"unterminated argument list":   "searched the function as text",
+	"unterminated coordinates":     "searched the function as text",
+	"coordinates cannot be nested": "searched the function as text",
+	"unclosed paren":               "closed the paren",
+}
+
+// ParseQueryStringWarnings parses a query string like ParseQueryString,
+// in lenient mode it also returns the warnings describing the changes
+// made to the query string so that it parses, in the order of their
+// offsets.  Without lenient mode there are no warnings.
+func ParseQueryStringWarnings(query string, options QueryStringOptions) (bluge.Query, []*Warning, error) {
+	if !options.lenient {
+		rq, err := ParseQueryString(query, options)
+		return rq, nil, err
+	}
+	return parseLenient(query, options)
+}
+
+// parseLenient parses a query string in lenient mode, which
+// returns a query for any query string and options, the invalid
+// minimum should match option is ignored with a warning
+func parseLenient(query string, options QueryStringOptions) (bluge.Query, []*Warning, error) {
+	if query == "" {
+		return bluge.NewMatchNoneQuery(), nil, nil
+	}
+
+	var warnings []*Warning
+	minShould, err := parseMinimumShouldMatch(options.minShouldMatch)
+	if err != nil {
+		perr := newParseError(0, 0, err.Error())
+		warnings = append(warnings, newWarning(query, 0, 0, "ignored the minimum should match", perr))
+		minShould = nil
+	}
+	root, changes := lenientAST(query, options)
+	warnings = append(warnings, changes...)
+	c := newCompiler(options, minShould)
+	rq, err := c.compileRoot(root)
+	if err != nil {
+		perr := newParseError(0, len(query), err.Error())
+		rq = bluge.NewMatchNoneQuery()
+		warnings = append(warnings, newWarning(query, 0, len(query), "left out the query", perr))
+	}
+	for _, err := range c.errs {
+		msg := "searched as text"
+		if strings.HasPrefix(err.Msg, "cannot boost") {
+			msg = "ignored the boost"
+		}
+		warnings = append(warnings, newWarning(query, err.Offset, err.end, msg, err))
+	}
+	if options.optimize {
+		rq = optimizeQuery(rq)
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Offset < warnings[j].Offset
+	})
+	return rq, warnings, nil
+}
+
+// lenientPasses bounds the number of times lenientAST parses a query
+// string, the errors left after the last pass are partial results
+const lenientPasses = 8
+
+// lenientAST parses a query string, dropping the tokens the parser
+// doesn't expect, and invalid boosts and fuzziness, until the parser
+// gets past all of its syntax errors.  Each pass drops the text of
+// all the errors it can.  Dropped tokens are replaced by spaces,
+// which keeps the offsets of the errors in the query string.  The
+// values which still fail to parse are Bad nodes, which compile
+// to a search for their text.
+func lenientAST(query string, options QueryStringOptions) (*Group, []*Warning) {
+	options.partialResults = true
+	text := []byte(query)
+	var warnings []*Warning
+	for pass := 1; ; pass++ {
+		if strings.TrimSpace(string(text)) == "" {
+			// all the tokens were dropped
+			return &Group{}, warnings
+		}
+		root, err := ParseAST(string(text), options)
+		errs, _ := err.(ParseErrors)
+		var changes []*Warning
+		if pass < lenientPasses {
+			changes = lenientRepair(query, string(text), errs, options)
+		}
+		if len(changes) == 0 {
+			for _, err := range errs {
+				msg, ok := lexerChanges[err.Msg]
+				if err.unexpected != 0 {
+					msg = "left out the clause"
+				} else if !ok {
+					msg = "searched as text"
+				}
+				warnings = append(warnings, newWarning(query, err.Offset, err.end, msg, err))
+			}
+			return root, warnings
+		}
+		for _, w := range changes {
+			for i := w.Offset; i < w.Offset+len(w.Token); i++ {
+				text[i] = ' '
+			}
+		}
+		warnings = append(warnings, changes...)
+	}
+}
+
+// lenientRepair returns the changes for the errors of text which
+// lenient parsing works around by dropping text, none when the
+// parser got past all the syntax errors.  The changes of an
+// error dropping text already dropped for another are skipped.
+func lenientRepair(query, text string, errs ParseErrors, options QueryStringOptions) []*Warning {
+	var rv []*Warning
+	var tokens []lexedToken
+	dropped := make(map[int]bool)
+	for _, err := range errs {
+		var changes []*Warning
+		switch {
+		case err.unexpected != 0:
+			if tokens == nil {
+				tokens = lexTokens(text, options)
+			}
+			changes = dropUnexpected(query, tokens, err)
+		case strings.HasPrefix(err.Token, "^"):
+			changes = []*Warning{newWarning(query, err.Offset, err.end, "ignored the invalid boost", err)}
+		case strings.HasPrefix(err.Token, "~"):
+			msg := "ignored the invalid fuzziness"
+			if strings.HasPrefix(err.Msg, "invalid slop") {
+				msg = "ignored the invalid slop"
+			}
+			changes = []*Warning{newWarning(query, err.Offset, err.end, msg, err)}
+		}
+		skip := false
+		for _, w := range changes {
+			skip = skip || dropped[w.Offset]
+		}
+		if skip {
+			continue
+		}
+		for _, w := range changes {
+			dropped[w.Offset] = true
+		}
+		rv = append(rv, changes...)
+	}
+	return rv
+}
+
+// lexedToken is a token of a query string from byte offset start up to end
+type lexedToken struct {
+	typ        int
+	start, end int
+}
+
+func lexTokens(query string, options QueryStringOptions) []lexedToken {
+	lex := newQueryStringLex(query, options)
+	var rv []lexedToken
+	var lval yySymType
+	for typ := lex.Lex(&lval); typ != 0; typ = lex.Lex(&lval) {
+		rv = append(rv, lexedToken{typ: typ, start: lval.start, end: lval.end})
+	}
+	return rv
+}
+
+// lexedText reports whether a token is text to search for,
+// rather than an operator, which lenient parsing may drop
+func lexedText(typ int) bool {
+	switch typ {
+	case tSTRING, tPHRASE, tNUMBER, tDATE, tFUNCTION:
+		return true
+	}
+	return false
+}
+
+// dropUnexpected returns the changes getting the parser past a
+// syntax error, given the tokens of the text.  Within a range
+// its brackets and TO are dropped, which leaves the bounds as
+// text to search for, otherwise the unexpected token is dropped,
+// or the token before it when the unexpected token is text.
+func dropUnexpected(query string, tokens []lexedToken, err *ParseError) []*Warning {
+	at := sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].start >= err.Offset
+	})
+
+	drop := func(t lexedToken, msg string) *Warning {
+		return newWarning(query, t.start, t.end, fmt.Sprintf(msg, tokenName(parserToken(t.typ))), err)
+	}
+
+	open := -1
+	for i, t := range tokens[:at] {
+		switch t.typ {
+		case tLBRACKET, tLBRACE:
+			open = i
+		case tRBRACKET, tRBRACE:
+			open = -1
+		}
+	}
+	if open >= 0 {
+		rv := []*Warning{drop(tokens[open], "dropped %s of an invalid range")}
+		for _, t := range tokens[open+1:] {
+			if t.typ == tTO {
+				rv = append(rv, drop(t, "dropped %s of an invalid range"))
+			} else if t.typ == tRBRACKET || t.typ == tRBRACE {
+				rv = append(rv, drop(t, "dropped %s of an invalid range"))
+				break
+			}
+		}
+		return rv
+	}
+
+	if at < len(tokens) && !lexedText(tokens[at].typ) {
+		return []*Warning{drop(tokens[at], "dropped stray %s")}
+	} else if at > 0 && !lexedText(tokens[at-1].typ) {
+		return []*Warning{drop(tokens[at-1], "dropped stray %s")}
+	}
+	return nil
+}
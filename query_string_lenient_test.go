@@ -0,0 +1,244 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blugelabs/bluge"
+)
+
+func TestParseLenient(t *testing.T) {
+	type warning struct {
+		offset int
+		token  string
+		msg    string
+	}
+
+	tests := []struct {
+		input    string
+		result   bluge.Query
+		warnings []warning
+	}{
+		{
+			input: `a:: b`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("b").SetField("a")),
+			warnings: []warning{{2, ":", "dropped stray :"}},
+		},
+		{
+			input: `a AND`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")),
+			warnings: []warning{{2, "AND", "dropped stray AND"}},
+		},
+		{
+			input: `a:>`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")),
+			warnings: []warning{
+				{1, ":", "dropped stray :"},
+				{2, ">", "dropped stray >"},
+			},
+		},
+		{
+			input: `) a (`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")),
+			warnings: []warning{
+				{0, ")", "dropped stray )"},
+				{4, "(", "dropped stray ("},
+			},
+		},
+		{
+			input: `f:-a`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a").SetField("f")),
+			warnings: []warning{{2, "-", "dropped stray -"}},
+		},
+		{
+			input: `(a "b c`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("a")).
+					AddShould(bluge.NewMatchPhraseQuery("b c"))),
+			warnings: []warning{
+				{0, "(", "closed the paren"},
+				{3, `"b c`, "closed the quote"},
+			},
+		},
+		{
+			input: `e:[1 TO ] f`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("1").SetField("e")).
+					AddShould(bluge.NewNumericRangeInclusiveQuery(1, 1, true, true).SetField("e"))).
+				AddShould(bluge.NewMatchQuery("f")),
+			warnings: []warning{
+				{2, "[", "dropped [ of an invalid range"},
+				{5, "TO", "dropped TO of an invalid range"},
+				{8, "]", "dropped ] of an invalid range"},
+			},
+		},
+		{
+			input: `c^x d~y "p q"~z`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("c")).
+				AddShould(bluge.NewMatchQuery("d")).
+				AddShould(bluge.NewMatchPhraseQuery("p q")),
+			warnings: []warning{
+				{1, "^x", "ignored the invalid boost"},
+				{5, "~y", "ignored the invalid fuzziness"},
+				{13, "~z", "ignored the invalid slop"},
+			},
+		},
+		{
+			input: `x:>2024-13-45 good`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery(">2024-13-45").SetField("x")).
+				AddShould(bluge.NewMatchQuery("good")),
+			warnings: []warning{{2, ">2024-13-45", "searched as text"}},
+		},
+		{
+			input: `name:ma*`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("ma*").SetField("name")),
+			warnings: []warning{{0, "name:ma*", "searched as text"}},
+		},
+		{
+			input: `near(1,2`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("near(1,2")),
+			warnings: []warning{{0, "near(1,2", "searched the function as text"}},
+		},
+		{
+			input:  `+ -`,
+			result: bluge.NewMatchNoneQuery(),
+			warnings: []warning{
+				{0, "+", "dropped stray +"},
+				{2, "-", "dropped stray -"},
+			},
+		},
+		{
+			input: `a AND b`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddMust(bluge.NewMatchQuery("a")).
+					AddMust(bluge.NewMatchQuery("b"))),
+		},
+	}
+
+	options := DefaultOptions().WithLenient(true).WithMinPrefixLength(3)
+	for _, test := range tests {
+		q, warnings, err := ParseQueryStringWarnings(test.input, options)
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, test.input)
+			continue
+		}
+		if !reflect.DeepEqual(q, test.result) {
+			t.Errorf("expected %#v, got %#v for %s", test.result, q, test.input)
+		}
+		var actual []warning
+		for _, w := range warnings {
+			actual = append(actual, warning{w.Offset, w.Token, w.Msg})
+			if w.Err == nil {
+				t.Errorf("expected the error of warning %s for %s", w, test.input)
+			}
+		}
+		if !reflect.DeepEqual(actual, test.warnings) {
+			t.Errorf("expected warnings %v, got %v for %s", test.warnings, actual, test.input)
+		}
+
+		q2, err := ParseQueryString(test.input, options)
+		if err != nil || !reflect.DeepEqual(q2, q) {
+			t.Errorf("expected the same query without warnings, got %#v, %v for %s", q2, err, test.input)
+		}
+	}
+}
+
+func TestParseQueryStringWarningsStrict(t *testing.T) {
+	q, warnings, err := ParseQueryStringWarnings(`a:: b`, DefaultOptions())
+	if err == nil || q != nil || warnings != nil {
+		t.Errorf("expected only an error, got %#v, %v, %v", q, warnings, err)
+	}
+}
+
+func TestParseLenientNeverFails(t *testing.T) {
+	const runes = `ab1 2.0,+-:"*()~^[]{}<>=!&|/@\TOANDR`
+	options := []QueryStringOptions{
+		DefaultOptions().WithLenient(true),
+		DefaultOptions().WithLenient(true).WithMinPrefixLength(3).WithOptimize(true),
+		DefaultOptions().WithLenient(true).WithDefaultFields(map[string]float64{"a": 1, "b": 2}),
+		DefaultOptions().WithLenient(true).WithKeywordOperators(false).WithMinimumShouldMatch("2<50%"),
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		input := make([]byte, rnd.Intn(14))
+		for j := range input {
+			input[j] = runes[rnd.Intn(len(runes))]
+		}
+		q, _, err := ParseQueryStringWarnings(string(input), options[rnd.Intn(len(options))])
+		if err != nil || q == nil {
+			t.Fatalf("expected a query, got %v for %s", err, input)
+		}
+	}
+}
+
+func TestParseLenientInvalidOptions(t *testing.T) {
+	options := DefaultOptions().WithLenient(true).WithMinimumShouldMatch("lots")
+	q, warnings, err := ParseQueryStringWarnings(`a b`, options)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := bluge.NewBooleanQuery().
+		AddShould(bluge.NewMatchQuery("a")).
+		AddShould(bluge.NewMatchQuery("b"))
+	if !reflect.DeepEqual(q, expected) {
+		t.Errorf("expected %#v, got %#v", expected, q)
+	}
+	if len(warnings) != 1 || warnings[0].Msg != "ignored the minimum should match" {
+		t.Errorf("expected a warning about the minimum should match, got %v", warnings)
+	}
+}
+
+func TestParseLenientManyErrors(t *testing.T) {
+	// each pass drops the text of all the errors, so
+	// that queries with many errors parse in a few passes
+	tests := []struct {
+		input    string
+		warnings int
+	}{
+		{input: `a^x `, warnings: 2000},
+		{input: `a) `, warnings: 2000},
+		{input: `a:: `, warnings: 3000},
+		{input: `f:[1 TO ] `, warnings: 6000},
+	}
+
+	options := DefaultOptions().WithLenient(true)
+	for _, test := range tests {
+		input := strings.Repeat(test.input, 2000)
+		q, warnings, err := ParseQueryStringWarnings(input, options)
+		if err != nil || q == nil {
+			t.Errorf("expected a query, got %v for %s", err, test.input)
+			continue
+		}
+		if len(warnings) != test.warnings {
+			t.Errorf("expected %d warnings, got %d for %s", test.warnings, len(warnings), test.input)
+		}
+	}
+}
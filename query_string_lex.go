@@ -18,8 +18,10 @@ import (
 	"bufio"
 	"io"
 	"log"
+	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const reservedChars = "+-=&|><!(){}[]^\"~*?:\\/ "
@@ -33,8 +35,29 @@ func unescape(escaped string) string {
 	return "\\" + escaped
 }
 
+// isoDateRegexp matches the ISO 8601 dates and date-times
+// which are lexed as dates without quotes in ranges
+var isoDateRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?)?)?$`)
+
+// functionCall is a function name followed by a parenthesized
+// argument list, like near(37.77,-122.41,5km), an argument
+// may itself be a parenthesized list of coordinates
+type functionCall struct {
+	name string
+	args []string
+}
+
+// functionNames are the names lexed as function calls
+// when directly followed by an opening paren
+var functionNames = map[string]bool{
+	"near":    true,
+	"bbox":    true,
+	"polygon": true,
+}
+
 type queryStringLex struct {
 	in            *bufio.Reader
+	query         string
 	buf           string
 	currState     lexState
 	currConsumed  bool
@@ -42,9 +65,20 @@ type queryStringLex struct {
 	nextToken     *yySymType
 	nextTokenType int
 	seenDot       bool
+	inRange       bool
+	afterPhrase   bool
+	lastTokenType int
+	funcName      string
+	args          []string
 	nextRune      rune
 	nextRuneSize  int
+	offset        int
+	tokenStart    int
 	atEOF         bool
+	errs          []*ParseError
+	keywords      bool
+	simple        bool
+	simpleFlags   SimpleFlags
 	debugLexer    bool
 	logger        *log.Logger
 }
@@ -53,10 +87,14 @@ func (l *queryStringLex) reset() {
 	l.buf = ""
 	l.inEscape = false
 	l.seenDot = false
+	l.funcName = ""
+	l.args = nil
 }
 
+// Error records an error of the text from the start of the
+// current token up to the current rune, lexing goes on
 func (l *queryStringLex) Error(msg string) {
-	panic(msg)
+	l.errs = append(l.errs, newParseError(l.tokenStart, l.offset, msg))
 }
 
 func (l *queryStringLex) Lex(lval *yySymType) int {
@@ -64,37 +102,60 @@ func (l *queryStringLex) Lex(lval *yySymType) int {
 
 	for l.nextToken == nil {
 		if l.currConsumed {
+			l.offset += l.nextRuneSize
 			l.nextRune, l.nextRuneSize, err = l.in.ReadRune()
 			if err != nil && err == io.EOF {
 				l.nextRune = 0
 				l.atEOF = true
 			} else if err != nil {
+				lval.start, lval.end = l.offset, l.offset
 				return 0
 			}
 		}
 		l.currState, l.currConsumed = l.currState(l, l.nextRune, l.atEOF)
 		if l.currState == nil {
+			lval.start, lval.end = l.offset, l.offset
 			return 0
 		}
 	}
 
+	// a token ends before the rune which ended it, unless that rune
+	// was consumed as part of the token, like the quote of a phrase
+	l.nextToken.start = l.tokenStart
+	l.nextToken.end = l.offset
+	if l.currConsumed && !unicode.IsSpace(l.nextRune) {
+		l.nextToken.end += l.nextRuneSize
+	}
+
 	*lval = *l.nextToken
 	rv := l.nextTokenType
+	l.lastTokenType = rv
 	l.nextToken = nil
 	l.nextTokenType = 0
 	return rv
 }
 
-func newQueryStringLex(in io.Reader, options QueryStringOptions) *queryStringLex {
+func newQueryStringLex(query string, options QueryStringOptions) *queryStringLex {
 	return &queryStringLex{
-		in:           bufio.NewReader(in),
+		in:           bufio.NewReader(strings.NewReader(query)),
+		query:        query,
 		currState:    startState,
 		currConsumed: true,
+		keywords:     options.keywordOperators,
+		simpleFlags:  options.simpleFlags,
 		debugLexer:   options.debugLexer,
 		logger:       options.logger,
 	}
 }
 
+// newSimpleQueryStringLex returns a lexer of the simple query string
+// syntax, which only has the operators enabled by the simple flags
+func newSimpleQueryStringLex(query string, options QueryStringOptions) *queryStringLex {
+	rv := newQueryStringLex(query, options)
+	rv.simple = true
+	return rv
+}
+
 type lexState func(l *queryStringLex, next rune, eof bool) (lexState, bool)
 
 func startState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
@@ -102,6 +163,22 @@ func startState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		return nil, false
 	}
 
+	// tokens start at the first rune which isn't skipped
+	if !l.inEscape {
+		l.tokenStart = l.offset
+	}
+
+	if l.simple {
+		return simpleStartState(l, next)
+	}
+
+	// an @ directly following a phrase or date starts its time zone
+	afterPhrase := l.afterPhrase
+	l.afterPhrase = false
+	if afterPhrase && next == '@' {
+		return inZoneState, true
+	}
+
 	// handle inside escape case up front
 	if l.inEscape {
 		l.inEscape = false
@@ -112,9 +189,19 @@ func startState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	switch next {
 	case '"':
 		return inPhraseState, true
-	case '+', '-', ':', '>', '<', '=':
+	case '/':
+		l.buf += string(next)
+		if l.regexpAhead() {
+			return inRegexpState, true
+		}
+		// a slash without a closing one is text, like a path
+		return inStrState, true
+	case '+', '-', ':', '>', '<', '=', '(', ')', '!', '[', ']', '{', '}':
 		l.buf += string(next)
 		return singleCharOpState, true
+	case '&', '|':
+		l.buf += string(next)
+		return doubleCharOpState, true
 	case '^':
 		return inBoostState, true
 	case '~':
@@ -139,14 +226,12 @@ func startState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 }
 
 func inPhraseState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
-	// unterminated phrase eats the phrase
-	if eof {
-		l.Error("unterminated quote")
-		return nil, false
-	}
-
-	// only a non-escaped " ends the phrase
-	if !l.inEscape && next == '"' {
+	// only a non-escaped " ends the phrase, an
+	// unterminated phrase is ended by the eof
+	if eof || (!l.inEscape && next == '"') {
+		if eof {
+			l.Error("unterminated quote")
+		}
 		// end phrase
 		l.nextTokenType = tPHRASE
 		l.nextToken = &yySymType{
@@ -154,8 +239,10 @@ func inPhraseState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		}
 		l.logDebugTokensf("PHRASE - '%s'", l.nextToken.s)
 		l.reset()
+		// only range bounds have a time zone
+		l.afterPhrase = l.inRange || l.inDatePosition()
 		return startState, true
-	} else if !l.inEscape && next == '\\' {
+	} else if !l.inEscape && next == '\\' && l.escapes() {
 		l.inEscape = true
 	} else if l.inEscape {
 		// if in escape, end it
@@ -168,6 +255,57 @@ func inPhraseState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	return inPhraseState, true
 }
 
+func inRegexpState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// regexpAhead found the closing slash, so the
+	// eof only ends a regexp it got wrong, as text
+	if eof {
+		l.nextTokenType = tSTRING
+		l.nextToken = &yySymType{
+			s: l.buf,
+		}
+		l.logDebugTokensf("STRING - '%s'", l.nextToken.s)
+		l.reset()
+		return startState, true
+	}
+
+	// only a non-escaped / ends the regexp, escapes are kept
+	// as they are so that the regexp syntax sees them
+	l.buf += string(next)
+	if !l.inEscape && next == '/' {
+		// end regexp, the surrounding slashes mark it as such
+		l.nextTokenType = tSTRING
+		l.nextToken = &yySymType{
+			s: l.buf,
+		}
+		l.logDebugTokensf("REGEXP - '%s'", l.nextToken.s)
+		l.reset()
+		return startState, true
+	}
+	l.inEscape = !l.inEscape && next == '\\'
+
+	return inRegexpState, true
+}
+
+// regexpAhead reports whether the slash starting the current token
+// is closed by a non-escaped slash which ends the token, so that
+// the text up to it is a regexp
+func (l *queryStringLex) regexpAhead() bool {
+	ahead := l.query[l.offset+l.nextRuneSize:]
+	inEscape := false
+	for i, r := range ahead {
+		if inEscape || r != '/' {
+			inEscape = !inEscape && r == '\\'
+			continue
+		}
+		if i+1 == len(ahead) {
+			return true
+		}
+		next, _ := utf8.DecodeRuneInString(ahead[i+1:])
+		return next == ' ' || next == '^' || next == '~' || l.closes(next)
+	}
+	return false
+}
+
 func singleCharOpState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	l.nextToken = &yySymType{}
 
@@ -190,12 +328,60 @@ func singleCharOpState(l *queryStringLex, next rune, eof bool) (lexState, bool)
 	case "=":
 		l.nextTokenType = tEQUAL
 		l.logDebugTokensf("EQUAL")
+	case "(":
+		l.nextTokenType = tLPAREN
+		l.logDebugTokensf("LPAREN")
+	case ")":
+		l.nextTokenType = tRPAREN
+		l.logDebugTokensf("RPAREN")
+	case "|":
+		l.nextTokenType = tOR
+		l.logDebugTokensf("OR")
+	case "!":
+		l.nextTokenType = tNOT
+		l.logDebugTokensf("NOT")
+	case "[":
+		l.nextTokenType = tLBRACKET
+		l.inRange = true
+		l.logDebugTokensf("LBRACKET")
+	case "]":
+		l.nextTokenType = tRBRACKET
+		l.inRange = false
+		l.logDebugTokensf("RBRACKET")
+	case "{":
+		l.nextTokenType = tLBRACE
+		l.inRange = true
+		l.logDebugTokensf("LBRACE")
+	case "}":
+		l.nextTokenType = tRBRACE
+		l.inRange = false
+		l.logDebugTokensf("RBRACE")
 	}
 
 	l.reset()
 	return startState, false
 }
 
+func doubleCharOpState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// a single & or | is just the start of a string
+	if eof || next != rune(l.buf[0]) {
+		return inStrState, false
+	}
+
+	l.nextToken = &yySymType{}
+	switch l.buf {
+	case "&":
+		l.nextTokenType = tAND
+		l.logDebugTokensf("AND")
+	case "|":
+		l.nextTokenType = tOR
+		l.logDebugTokensf("OR")
+	}
+
+	l.reset()
+	return startState, true
+}
+
 func inBoostState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	return inBoostOrTildeState(l, next, eof, tBOOST, "BOOST", inBoostState)
 }
@@ -207,8 +393,10 @@ func inTildeState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 func inBoostOrTildeState(l *queryStringLex, next rune, eof bool, nextTokenType int, name string,
 	inState lexState) (lexState, bool) {
 
-	// only a non-escaped space ends the boost (or eof)
-	if eof || (!l.inEscape && next == ' ') {
+	// only a non-escaped space or closing bracket ends the boost (or eof),
+	// a tilde can also be followed by a boost
+	if eof || (!l.inEscape && (next == ' ' || l.closes(next) || (next != '-' && l.simpleOperator(next)) ||
+		(nextTokenType == tTILDE && next == '^'))) {
 		// end boost or tilde
 		l.nextTokenType = nextTokenType
 		if l.buf == "" {
@@ -219,8 +407,8 @@ func inBoostOrTildeState(l *queryStringLex, next rune, eof bool, nextTokenType i
 		}
 		l.logDebugTokensf("%s - '%s'", name, l.nextToken.s)
 		l.reset()
-		return startState, true
-	} else if !l.inEscape && next == '\\' {
+		return startState, eof || next == ' '
+	} else if !l.inEscape && next == '\\' && l.escapes() {
 		l.inEscape = true
 	} else if l.inEscape {
 		// if in escape, end it
@@ -234,8 +422,8 @@ func inBoostOrTildeState(l *queryStringLex, next rune, eof bool, nextTokenType i
 }
 
 func inNumOrStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
-	// only a non-escaped space ends the tilde (or eof)
-	if eof || (!l.inEscape && next == ' ') {
+	// only a non-escaped space or closing bracket ends the number (or eof)
+	if eof || (!l.inEscape && (next == ' ' || l.closes(next))) {
 		// end number
 		l.nextTokenType = tNUMBER
 		l.nextToken = &yySymType{
@@ -243,7 +431,7 @@ func inNumOrStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		}
 		l.logDebugTokensf("NUMBER - '%s'", l.nextToken.s)
 		l.reset()
-		return startState, true
+		return startState, eof || next == ' '
 	} else if !l.inEscape && next == '\\' {
 		l.inEscape = true
 		return inNumOrStrState, true
@@ -257,7 +445,11 @@ func inNumOrStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	}
 
 	// see where to go
-	if !l.seenDot && next == '.' {
+	if !l.seenDot && next == '-' && len(l.buf) == 4 && l.inDatePosition() {
+		// looks like the year of a date
+		l.buf += string(next)
+		return inDateState, true
+	} else if !l.seenDot && next == '.' {
 		// stay in this state
 		l.seenDot = true
 		l.buf += string(next)
@@ -273,20 +465,32 @@ func inNumOrStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 }
 
 func inStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
-	// end on non-escped space, colon, tilde, boost (or eof)
-	if eof || (!l.inEscape && (next == ' ' || next == ':' || next == '^' || next == '~')) {
+	// a function name directly followed by an opening paren starts the arguments
+	if !eof && !l.inEscape && next == '(' && functionNames[l.buf] {
+		l.funcName = l.buf
+		l.buf = ""
+		return inArgsState, true
+	}
+
+	// end on non-escped space, colon, tilde, boost, closing bracket (or eof)
+	// keywords are also ended by an opening paren
+	if eof || (!l.inEscape && (next == ' ' || next == ':' || next == '^' || next == '~' || l.closes(next) ||
+		(next == '(' && l.keywordTokenType() != 0))) {
 		// end string
 		l.nextTokenType = tSTRING
 		l.nextToken = &yySymType{
 			s: l.buf,
 		}
-		l.logDebugTokensf("STRING - '%s'", l.nextToken.s)
+		keywordTokenType := l.keywordTokenType()
+		if keywordTokenType != 0 && (eof || next == ' ' || next == '(' || l.closes(next)) {
+			l.nextTokenType = keywordTokenType
+			l.logDebugTokensf("%s", l.nextToken.s)
+		} else {
+			l.logDebugTokensf("STRING - '%s'", l.nextToken.s)
+		}
 		l.reset()
 
-		consumed := true
-		if !eof && (next == ':' || next == '^' || next == '~') {
-			consumed = false
-		}
+		consumed := eof || next == ' '
 
 		return startState, consumed
 	} else if !l.inEscape && next == '\\' {
@@ -302,6 +506,252 @@ func inStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	return inStrState, true
 }
 
+func inZoneState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// only a space, closing bracket or boost ends the zone (or eof)
+	if eof || next == ' ' || next == '^' || l.closes(next) {
+		if l.buf == "" {
+			// the @ is dropped
+			l.Error("missing time zone")
+			return startState, eof || next == ' '
+		}
+		// end zone
+		l.nextTokenType = tZONE
+		l.nextToken = &yySymType{
+			s: l.buf,
+		}
+		l.logDebugTokensf("ZONE - '%s'", l.nextToken.s)
+		l.reset()
+		return startState, eof || next == ' '
+	}
+
+	l.buf += string(next)
+	return inZoneState, true
+}
+
+func inDateState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// end like a string, except that the time of a date-time contains
+	// colons, and that a date may be followed by its time zone
+	if eof || (!l.inEscape && (next == ' ' || next == '^' || next == '~' || next == '@' || l.closes(next) ||
+		(next == ':' && !strings.Contains(l.buf, "T")))) {
+		// end date
+		l.nextTokenType = tSTRING
+		l.nextToken = &yySymType{
+			s: l.buf,
+		}
+		if isoDateRegexp.MatchString(l.buf) {
+			l.nextTokenType = tDATE
+			l.logDebugTokensf("DATE - '%s'", l.nextToken.s)
+		} else {
+			l.logDebugTokensf("STRING - '%s'", l.nextToken.s)
+		}
+		l.reset()
+		l.afterPhrase = l.nextTokenType == tDATE
+		return startState, eof || next == ' '
+	} else if !l.inEscape && next == '\\' {
+		l.inEscape = true
+	} else if l.inEscape {
+		// if in escape, end it
+		l.inEscape = false
+		l.buf += unescape(string(next))
+	} else {
+		l.buf += string(next)
+	}
+
+	return inDateState, true
+}
+
+func inArgsState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// unterminated argument list is lexed as a string
+	if eof {
+		l.Error("unterminated argument list")
+		return l.unterminatedFunction()
+	}
+
+	switch next {
+	case '(':
+		// start coordinates, kept with their parens
+		l.buf += string(next)
+		return inCoordsState, true
+	case ',':
+		// end argument
+		l.args = append(l.args, strings.TrimSpace(l.buf))
+		l.buf = ""
+	case ')':
+		// end function call
+		l.args = append(l.args, strings.TrimSpace(l.buf))
+		l.nextTokenType = tFUNCTION
+		l.nextToken = &yySymType{
+			fn: functionCall{
+				name: l.funcName,
+				args: l.args,
+			},
+		}
+		l.logDebugTokensf("FUNCTION - '%s' %q", l.nextToken.fn.name, l.nextToken.fn.args)
+		l.reset()
+		return startState, true
+	default:
+		l.buf += string(next)
+	}
+
+	return inArgsState, true
+}
+
+func inCoordsState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// unterminated coordinates are lexed as a string
+	if eof {
+		l.Error("unterminated coordinates")
+		return l.unterminatedFunction()
+	}
+
+	switch next {
+	case '(':
+		// the paren is kept, the coordinates won't parse
+		l.errs = append(l.errs, newParseError(l.offset, l.offset+l.nextRuneSize, "coordinates cannot be nested"))
+	case ')':
+		// end coordinates, back to the argument list
+		l.buf += string(next)
+		return inArgsState, true
+	}
+
+	l.buf += string(next)
+	return inCoordsState, true
+}
+
+// unterminatedFunction ends a function call without its closing
+// paren as a string of the function call read so far
+func (l *queryStringLex) unterminatedFunction() (lexState, bool) {
+	l.nextTokenType = tSTRING
+	l.nextToken = &yySymType{
+		s: l.funcName + "(" + strings.Join(append(l.args, l.buf), ","),
+	}
+	l.logDebugTokensf("STRING - '%s'", l.nextToken.s)
+	l.reset()
+	return startState, true
+}
+
+// closes reports whether the rune is a bracket
+// closing the group or range currently lexed
+func (l *queryStringLex) closes(next rune) bool {
+	if l.simple {
+		// the simple syntax ends tokens at its operators
+		return false
+	}
+	return next == ')' || (l.inRange && (next == ']' || next == '}'))
+}
+
+// inDatePosition reports whether the token being lexed
+// is a range bound, where dates need no quotes
+func (l *queryStringLex) inDatePosition() bool {
+	switch l.lastTokenType {
+	case tGREATER, tLESS, tEQUAL, tLBRACKET, tLBRACE, tTO:
+		return true
+	}
+	return false
+}
+
+// simpleStartState starts the tokens of the simple syntax, the
+// runes of the operators which are disabled are text
+func simpleStartState(l *queryStringLex, next rune) (lexState, bool) {
+	if l.inEscape {
+		l.inEscape = false
+		l.buf += unescape(string(next))
+		return inSimpleStrState, true
+	}
+
+	switch {
+	case next == '\\' && l.escapes():
+		l.inEscape = true
+		return startState, true
+	case next == '"' && l.simpleOperator(next):
+		return inPhraseState, true
+	case next == '~' && l.simpleOperator(next):
+		return inTildeState, true
+	case l.simpleOperator(next):
+		l.buf += string(next)
+		return singleCharOpState, true
+	case !unicode.IsSpace(next):
+		l.buf += string(next)
+		return inSimpleStrState, true
+	}
+
+	// doesn't look like anything, just eat it and stay here
+	l.reset()
+	return startState, true
+}
+
+func inSimpleStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// end on a non-escaped space or operator (or eof),
+	// a - within a term is part of it
+	if eof || (!l.inEscape && (unicode.IsSpace(next) || (next != '-' && l.simpleOperator(next)))) {
+		// end string
+		l.nextTokenType = tSTRING
+		l.nextToken = &yySymType{
+			s: l.buf,
+		}
+		l.logDebugTokensf("STRING - '%s'", l.nextToken.s)
+		l.reset()
+		return startState, eof || unicode.IsSpace(next)
+	} else if !l.inEscape && next == '\\' && l.escapes() {
+		l.inEscape = true
+	} else if l.inEscape {
+		// if in escape, end it
+		l.inEscape = false
+		l.buf += unescape(string(next))
+	} else {
+		l.buf += string(next)
+	}
+
+	return inSimpleStrState, true
+}
+
+// simpleOperator reports whether the rune is an enabled
+// operator of the simple syntax, when lexing that syntax
+func (l *queryStringLex) simpleOperator(next rune) bool {
+	if !l.simple {
+		return false
+	}
+	switch next {
+	case '+':
+		return l.simpleFlags&SimpleAnd != 0
+	case '|':
+		return l.simpleFlags&SimpleOr != 0
+	case '-':
+		return l.simpleFlags&SimpleNot != 0
+	case '"':
+		return l.simpleFlags&SimplePhrase != 0
+	case '(', ')':
+		return l.simpleFlags&SimplePrecedence != 0
+	case '~':
+		return l.simpleFlags&(SimpleFuzzy|SimpleSlop) != 0
+	}
+	return false
+}
+
+// escapes reports whether a backslash escapes the rune following it
+func (l *queryStringLex) escapes() bool {
+	return !l.simple || l.simpleFlags&SimpleEscape != 0
+}
+
+// keywordTokenType returns the token type of the keyword
+// in the buffer, or 0 if it is none
+func (l *queryStringLex) keywordTokenType() int {
+	if l.inRange && l.buf == "TO" {
+		return tTO
+	}
+	if !l.keywords {
+		return 0
+	}
+	switch l.buf {
+	case "AND":
+		return tAND
+	case "OR":
+		return tOR
+	case "NOT":
+		return tNOT
+	}
+	return 0
+}
+
 func (l *queryStringLex) logDebugTokensf(format string, v ...interface{}) {
 	if l.debugLexer {
 		l.logger.Printf(format, v...)
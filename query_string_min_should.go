@@ -0,0 +1,122 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minShouldValue is a number of should clauses, either absolute or
+// as a percentage, a negative value counts the clauses not required
+type minShouldValue struct {
+	n       int
+	percent bool
+}
+
+func (v minShouldValue) required(count int) int {
+	n := v.n
+	if v.percent {
+		if n < 0 {
+			n = -(count * -n / 100)
+		} else {
+			n = count * n / 100
+		}
+	}
+	if n < 0 {
+		n += count
+	}
+	if n < 0 {
+		return 0
+	} else if n > count {
+		return count
+	}
+	return n
+}
+
+// minShouldCondition applies its value when
+// there are more than above should clauses
+type minShouldCondition struct {
+	above int
+	value minShouldValue
+}
+
+// minimumShouldMatch is a parsed minimum should match specification,
+// its conditions are ordered by the number of clauses they apply above
+type minimumShouldMatch []minShouldCondition
+
+// parseMinimumShouldMatch parses the specification formats known from
+// Elasticsearch: "3", "-2", "75%", "-25%", "3<90%" and "2<-25% 9<-3"
+func parseMinimumShouldMatch(spec string) (minimumShouldMatch, error) {
+	parts := strings.Fields(spec)
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	var rv minimumShouldMatch
+	for _, part := range parts {
+		var c minShouldCondition
+		var err error
+		if i := strings.Index(part, "<"); i >= 0 {
+			c.above, err = strconv.Atoi(part[:i])
+			if err != nil || c.above < 0 {
+				return nil, fmt.Errorf("invalid minimum should match condition: %s", part)
+			}
+			part = part[i+1:]
+		} else if len(parts) > 1 {
+			return nil, fmt.Errorf("minimum should match combinations must be conditional: %s", spec)
+		}
+		c.value, err = parseMinShouldValue(part)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, c)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].above < rv[j].above
+	})
+	return rv, nil
+}
+
+func parseMinShouldValue(str string) (minShouldValue, error) {
+	var rv minShouldValue
+	if strings.HasSuffix(str, "%") {
+		rv.percent = true
+		str = str[:len(str)-1]
+	}
+	var err error
+	rv.n, err = strconv.Atoi(str)
+	if err != nil {
+		return rv, fmt.Errorf("invalid minimum should match value: %v", err)
+	}
+	if rv.percent && (rv.n < -100 || rv.n > 100) {
+		return rv, fmt.Errorf("invalid minimum should match percentage: %d%%", rv.n)
+	}
+	return rv, nil
+}
+
+// required returns how many of count should clauses must match
+func (m minimumShouldMatch) required(count int) int {
+	rv := count
+	for _, c := range m {
+		if count <= c.above {
+			break
+		}
+		rv = c.value.required(count)
+	}
+	return rv
+}
@@ -0,0 +1,69 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"testing"
+)
+
+func TestMinimumShouldMatch(t *testing.T) {
+	tests := []struct {
+		spec     string
+		count    int
+		required int
+	}{
+		{spec: "2", count: 5, required: 2},
+		{spec: "7", count: 5, required: 5},
+		{spec: "-2", count: 5, required: 3},
+		{spec: "-7", count: 5, required: 0},
+		{spec: "75%", count: 5, required: 3},
+		{spec: "-25%", count: 5, required: 4},
+		{spec: "100%", count: 5, required: 5},
+		{spec: "3<90%", count: 3, required: 3},
+		{spec: "3<90%", count: 10, required: 9},
+		{spec: "2<-25% 9<-3", count: 2, required: 2},
+		{spec: "2<-25% 9<-3", count: 8, required: 6},
+		{spec: "9<-3 2<-25%", count: 12, required: 9},
+	}
+
+	for _, test := range tests {
+		m, err := parseMinimumShouldMatch(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if required := m.required(test.count); required != test.required {
+			t.Errorf("expected %d, got %d for %s with %d clauses", test.required, required, test.spec, test.count)
+		}
+	}
+}
+
+func TestMinimumShouldMatchInvalid(t *testing.T) {
+	tests := []string{
+		"x",
+		"50%%",
+		"150%",
+		"2 3",
+		"a<50%",
+		"-1<50%",
+		"3<",
+	}
+
+	for _, test := range tests {
+		_, err := parseMinimumShouldMatch(test)
+		if err == nil {
+			t.Errorf("expected error, got nil for `%s`", test)
+		}
+	}
+}
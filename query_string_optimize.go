@@ -0,0 +1,293 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"reflect"
+
+	"github.com/blugelabs/bluge"
+)
+
+// optimizeQuery simplifies a query, the result matches the same
+// documents though the scores may differ.  Boolean queries are
+// flattened into the boolean queries containing them, boolean
+// queries of a single clause are replaced by the clause and
+// duplicate clauses are removed.  Required numeric and date ranges
+// of the same field are merged into one range, a query requiring
+// an empty range matches no documents.
+func optimizeQuery(q bluge.Query) bluge.Query {
+	bq, ok := q.(*bluge.BooleanQuery)
+	if !ok {
+		if emptyRange(q) {
+			return bluge.NewMatchNoneQuery()
+		}
+		return q
+	}
+	return optimizeBoolean(bq)
+}
+
+func optimizeBoolean(q *bluge.BooleanQuery) bluge.Query {
+	minShould := q.MinShould()
+
+	var musts, shoulds, mustNots []bluge.Query
+	var exclusions []bluge.Query
+	for _, clause := range q.Musts() {
+		clause = optimizeQuery(clause)
+		if isMatchNone(clause) {
+			// a required clause which can't match
+			return bluge.NewMatchNoneQuery()
+		}
+		if flattenRequired(clause) {
+			child := clause.(*bluge.BooleanQuery)
+			if len(child.Musts()) == 0 {
+				exclusions = append(exclusions, clause)
+				continue
+			}
+			musts = append(musts, child.Musts()...)
+			mustNots = append(mustNots, child.MustNots()...)
+			continue
+		}
+		musts = append(musts, clause)
+	}
+	for _, clause := range exclusions {
+		// without a required clause left the optional
+		// clauses would become required, so it is kept
+		if len(musts) == 0 {
+			musts = append(musts, exclusions...)
+			break
+		}
+		mustNots = append(mustNots, clause.(*bluge.BooleanQuery).MustNots()...)
+	}
+	for _, clause := range q.Shoulds() {
+		clause = optimizeQuery(clause)
+		if isMatchNone(clause) {
+			continue
+		}
+		if minShould == 0 && flattenOptional(clause) {
+			shoulds = append(shoulds, clause.(*bluge.BooleanQuery).Shoulds()...)
+			continue
+		}
+		shoulds = append(shoulds, clause)
+	}
+	for _, clause := range q.MustNots() {
+		clause = optimizeQuery(clause)
+		if isMatchNone(clause) {
+			continue
+		}
+		if flattenOptional(clause) {
+			// not any of the clauses is none of the clauses
+			mustNots = append(mustNots, clause.(*bluge.BooleanQuery).Shoulds()...)
+			continue
+		}
+		mustNots = append(mustNots, clause)
+	}
+
+	if len(musts) == 0 && len(q.Shoulds()) > 0 && len(shoulds) == 0 {
+		// none of the optional clauses can match, though one must
+		return bluge.NewMatchNoneQuery()
+	}
+	if minShould > len(shoulds) {
+		return bluge.NewMatchNoneQuery()
+	}
+	if len(musts)+len(shoulds)+len(mustNots) == 0 {
+		// only excluded clauses which can't match
+		return bluge.NewMatchAllQuery()
+	}
+
+	musts = uniqueQueries(musts)
+	if minShould == 0 {
+		shoulds = uniqueQueries(shoulds)
+	}
+	mustNots = uniqueQueries(mustNots)
+	musts, ok := mergeRanges(musts)
+	if !ok {
+		return bluge.NewMatchNoneQuery()
+	}
+
+	if len(mustNots) == 0 && minShould <= 1 {
+		var single bluge.Query
+		if len(musts) == 1 && len(shoulds) == 0 {
+			single = musts[0]
+		} else if len(musts) == 0 && len(shoulds) == 1 {
+			single = shoulds[0]
+		}
+		if single != nil {
+			if rv, ok := withBoost(single, q.Boost()); ok {
+				return rv
+			}
+		}
+	}
+
+	rv := bluge.NewBooleanQuery()
+	rv.AddMust(musts...)
+	rv.AddShould(shoulds...)
+	rv.AddMustNot(mustNots...)
+	if minShould > 0 {
+		rv.SetMinShould(minShould)
+	}
+	if q.Boost() != noBoost {
+		rv.SetBoost(q.Boost())
+	}
+	return rv
+}
+
+// flattenRequired reports whether the clauses of a required
+// clause can be added to the enclosing query, which is the case
+// for boolean queries of only required and excluded clauses,
+// those of only excluded clauses need a required clause of the
+// enclosing query to take their place
+func flattenRequired(q bluge.Query) bool {
+	bq, ok := q.(*bluge.BooleanQuery)
+	return ok && bq.Boost() == noBoost && len(bq.Shoulds()) == 0
+}
+
+// flattenOptional reports whether a boolean query is only
+// optional clauses, any of which may match
+func flattenOptional(q bluge.Query) bool {
+	bq, ok := q.(*bluge.BooleanQuery)
+	return ok && bq.Boost() == noBoost && bq.MinShould() == 0 &&
+		len(bq.Musts()) == 0 && len(bq.MustNots()) == 0 && len(bq.Shoulds()) > 0
+}
+
+func isMatchNone(q bluge.Query) bool {
+	_, ok := q.(*bluge.MatchNoneQuery)
+	return ok
+}
+
+// withBoost returns the query with its boost multiplied
+// by boost, when the query type allows it
+func withBoost(q bluge.Query, boost float64) (bluge.Query, bool) {
+	if boost == noBoost {
+		return q, true
+	}
+	boosted, ok := q.(interface{ Boost() float64 })
+	if !ok {
+		return nil, false
+	}
+	rv, err := queryStringSetBoost(q, boosted.Boost()*boost)
+	return rv, err == nil
+}
+
+// uniqueQueries removes the queries equal to an earlier query
+func uniqueQueries(queries []bluge.Query) []bluge.Query {
+	rv := queries[:0]
+outer:
+	for _, q := range queries {
+		for _, seen := range rv {
+			if reflect.DeepEqual(q, seen) {
+				continue outer
+			}
+		}
+		rv = append(rv, q)
+	}
+	return rv
+}
+
+// mergeRanges merges the numeric and date ranges of the
+// same field without a boost into their intersection, which
+// takes the place of the first of them, ok is false when
+// an intersection is empty
+func mergeRanges(queries []bluge.Query) (rv []bluge.Query, ok bool) {
+	numeric := map[string]int{}
+	date := map[string]int{}
+	for _, q := range queries {
+		switch v := q.(type) {
+		case *bluge.NumericRangeQuery:
+			if i, seen := numeric[v.Field()]; seen && v.Boost() == noBoost {
+				rv[i] = intersectNumericRanges(rv[i].(*bluge.NumericRangeQuery), v)
+				continue
+			} else if !seen && v.Boost() == noBoost {
+				numeric[v.Field()] = len(rv)
+			}
+		case *bluge.DateRangeQuery:
+			if i, seen := date[v.Field()]; seen && v.Boost() == noBoost {
+				rv[i] = intersectDateRanges(rv[i].(*bluge.DateRangeQuery), v)
+				continue
+			} else if !seen && v.Boost() == noBoost {
+				date[v.Field()] = len(rv)
+			}
+		}
+		rv = append(rv, q)
+	}
+	for _, q := range rv {
+		if emptyRange(q) {
+			return nil, false
+		}
+	}
+	return rv, true
+}
+
+func intersectNumericRanges(a, b *bluge.NumericRangeQuery) *bluge.NumericRangeQuery {
+	minA, minAInclusive := a.Min()
+	minB, minBInclusive := b.Min()
+	maxA, maxAInclusive := a.Max()
+	maxB, maxBInclusive := b.Max()
+
+	min, minInclusive := minA, minAInclusive
+	if minB > minA {
+		min, minInclusive = minB, minBInclusive
+	} else if minB == minA {
+		minInclusive = minAInclusive && minBInclusive
+	}
+	max, maxInclusive := maxA, maxAInclusive
+	if maxB < maxA {
+		max, maxInclusive = maxB, maxBInclusive
+	} else if maxB == maxA {
+		maxInclusive = maxAInclusive && maxBInclusive
+	}
+	return bluge.NewNumericRangeInclusiveQuery(min, max, minInclusive, maxInclusive).SetField(a.Field())
+}
+
+// intersectDateRanges intersects two date ranges,
+// a zero time is an unbounded end
+func intersectDateRanges(a, b *bluge.DateRangeQuery) *bluge.DateRangeQuery {
+	startA, startAInclusive := a.Start()
+	startB, startBInclusive := b.Start()
+	endA, endAInclusive := a.End()
+	endB, endBInclusive := b.End()
+
+	start, startInclusive := startA, startAInclusive
+	if startA.IsZero() || (!startB.IsZero() && startB.After(startA)) {
+		start, startInclusive = startB, startBInclusive
+	} else if startB.Equal(startA) {
+		startInclusive = startAInclusive && startBInclusive
+	}
+	end, endInclusive := endA, endAInclusive
+	if endA.IsZero() || (!endB.IsZero() && endB.Before(endA)) {
+		end, endInclusive = endB, endBInclusive
+	} else if endB.Equal(endA) {
+		endInclusive = endAInclusive && endBInclusive
+	}
+	return bluge.NewDateRangeInclusiveQuery(start, end, startInclusive, endInclusive).SetField(a.Field())
+}
+
+// emptyRange reports whether a query is a numeric
+// or date range which no value is within
+func emptyRange(q bluge.Query) bool {
+	switch v := q.(type) {
+	case *bluge.NumericRangeQuery:
+		min, minInclusive := v.Min()
+		max, maxInclusive := v.Max()
+		return min > max || (min == max && !(minInclusive && maxInclusive))
+	case *bluge.DateRangeQuery:
+		start, startInclusive := v.Start()
+		end, endInclusive := v.End()
+		if start.IsZero() || end.IsZero() {
+			return false
+		}
+		return start.After(end) || (start.Equal(end) && !(startInclusive && endInclusive))
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blugelabs/bluge"
+)
+
+func TestOptimizeQuery(t *testing.T) {
+	theDate := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	options := DefaultOptions().WithOptimize(true)
+
+	tests := []struct {
+		input   string
+		options QueryStringOptions
+		result  bluge.Query
+	}{
+		{
+			input:   `marty`,
+			options: options,
+			result:  bluge.NewMatchQuery("marty"),
+		},
+		{
+			input:   `name:marty^2`,
+			options: options,
+			result:  bluge.NewMatchQuery("marty").SetField("name").SetBoost(2),
+		},
+		{
+			input:   `(name:marty)^2`,
+			options: options,
+			result:  bluge.NewMatchQuery("marty").SetField("name").SetBoost(2),
+		},
+		{
+			input:   `(name:marty^3)^2`,
+			options: options,
+			result:  bluge.NewMatchQuery("marty").SetField("name").SetBoost(6),
+		},
+		{
+			input:   `a a b a`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")),
+		},
+		{
+			input:   `a (b (c d)) -(e f)`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")).
+				AddShould(bluge.NewMatchQuery("c")).
+				AddShould(bluge.NewMatchQuery("d")).
+				AddMustNot(bluge.NewMatchQuery("e")).
+				AddMustNot(bluge.NewMatchQuery("f")),
+		},
+		{
+			input:   `+a +(+b -c) d`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("a")).
+				AddMust(bluge.NewMatchQuery("b")).
+				AddShould(bluge.NewMatchQuery("d")).
+				AddMustNot(bluge.NewMatchQuery("c")),
+		},
+		{
+			// the excluding clause is kept, so that b stays optional
+			input:   `+(-a) b`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddMustNot(bluge.NewMatchQuery("a"))).
+				AddShould(bluge.NewMatchQuery("b")),
+		},
+		{
+			input:   `+(-a -c) b`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddMustNot(bluge.NewMatchQuery("a")).
+					AddMustNot(bluge.NewMatchQuery("c"))).
+				AddShould(bluge.NewMatchQuery("b")),
+		},
+		{
+			input:   `+a +(-c) d`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("d")).
+				AddMustNot(bluge.NewMatchQuery("c")),
+		},
+		{
+			input:   `a (b c)^2`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("b")).
+					AddShould(bluge.NewMatchQuery("c")).
+					SetBoost(2)),
+		},
+		{
+			input:   `5`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("5")).
+				AddShould(bluge.NewNumericRangeInclusiveQuery(5, 5, true, true)),
+		},
+		{
+			input:   `a OR b`,
+			options: options.WithDefaultOperator(AndOperator),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")),
+		},
+		{
+			input:   `a AND (b AND c) AND NOT d`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("a")).
+				AddMust(bluge.NewMatchQuery("b")).
+				AddMust(bluge.NewMatchQuery("c")).
+				AddMustNot(bluge.NewMatchQuery("d")),
+		},
+		{
+			input:   `+f:>5 +f:<10`,
+			options: options,
+			result:  bluge.NewNumericRangeInclusiveQuery(5, 10, false, false).SetField("f"),
+		},
+		{
+			input:   `f:>5 f:<=10 f:>=7 g:<3 marty`,
+			options: options.WithDefaultOperator(AndOperator),
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewNumericRangeInclusiveQuery(7, 10, true, true).SetField("f")).
+				AddMust(bluge.NewNumericRangeInclusiveQuery(math.Inf(-1), 3, true, false).SetField("g")).
+				AddMust(bluge.NewMatchQuery("marty")),
+		},
+		{
+			input:   `f:>5 f:<10`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(5, math.Inf(1), false, true).SetField("f")).
+				AddShould(bluge.NewNumericRangeInclusiveQuery(math.Inf(-1), 10, true, false).SetField("f")),
+		},
+		{
+			input:   `+created:>=2024-05-01 +created:<=2024-05-01`,
+			options: options,
+			result:  bluge.NewDateRangeInclusiveQuery(theDate, theDate, true, true).SetField("created"),
+		},
+		{
+			input:   `+f:>10 +f:<5 marty`,
+			options: options,
+			result:  bluge.NewMatchNoneQuery(),
+		},
+		{
+			input:   `+f:>5 +f:<5`,
+			options: options,
+			result:  bluge.NewMatchNoneQuery(),
+		},
+		{
+			input:   `+created:>2024-05-01 +created:<2024-05-01`,
+			options: options,
+			result:  bluge.NewMatchNoneQuery(),
+		},
+		{
+			input:   `marty f:[10 TO 5]`,
+			options: options,
+			result:  bluge.NewMatchQuery("marty"),
+		},
+		{
+			input:   `marty -(+f:>10 +f:<5)`,
+			options: options,
+			result:  bluge.NewMatchQuery("marty"),
+		},
+		{
+			input:   `+f:>5 +(f:<10)^2`,
+			options: options,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewNumericRangeInclusiveQuery(5, math.Inf(1), false, true).SetField("f")).
+				AddMust(bluge.NewNumericRangeInclusiveQuery(math.Inf(-1), 10, true, false).SetField("f").SetBoost(2)),
+		},
+		{
+			input:   `a b c`,
+			options: options.WithMinimumShouldMatch("2"),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")).
+				AddShould(bluge.NewMatchQuery("c")).
+				SetMinShould(2),
+		},
+	}
+
+	for _, test := range tests {
+		q, err := ParseQueryString(test.input, test.options)
+		if err != nil {
+			t.Fatalf("unexpected error %v parsing %s", err, test.input)
+		}
+		if !reflect.DeepEqual(q, test.result) {
+			t.Errorf("expected %#v, got %#v for %s", test.result, q, test.input)
+		}
+	}
+}
@@ -36,16 +36,41 @@ import (
 	"github.com/blugelabs/bluge"
 )
 
+// Operator decides how clauses without
+// a + or - prefix are combined
+type Operator int
+
+const (
+	// OrOperator makes unprefixed clauses optional
+	OrOperator Operator = iota
+	// AndOperator makes unprefixed clauses required
+	AndOperator
+)
+
 type QueryStringOptions struct {
-	debugParser bool
-	debugLexer  bool
-	dateFormat  string
-	logger      *log.Logger
+	debugParser      bool
+	debugLexer       bool
+	dateFormats      []string
+	fieldDateFormats map[string][]string
+	location         *time.Location
+	keywordOperators bool
+	defaultOperator  Operator
+	defaultFields    map[string]float64
+	minShouldMatch   string
+	minPrefixLength  int
+	now              func() time.Time
+	optimize         bool
+	partialResults   bool
+	lenient          bool
+	simpleFlags      SimpleFlags
+	logger           *log.Logger
 }
 
 func DefaultOptions() QueryStringOptions {
 	return QueryStringOptions{
-		dateFormat: time.RFC3339,
+		dateFormats:      append([]string(nil), DefaultDateFormats...),
+		keywordOperators: true,
+		simpleFlags:      SimpleAll,
 	}
 }
 
@@ -60,7 +85,114 @@ func (o QueryStringOptions) WithDebugLexer(debug bool) QueryStringOptions {
 }
 
 func (o QueryStringOptions) WithDateFormat(dateFormat string) QueryStringOptions {
-	o.dateFormat = dateFormat
+	o.dateFormats = []string{dateFormat}
+	return o
+}
+
+// WithDateFormats sets the date formats tried in turn when parsing
+// the dates of a date range, each is a time layout or one of
+// EpochSeconds and EpochMillis
+func (o QueryStringOptions) WithDateFormats(dateFormats ...string) QueryStringOptions {
+	o.dateFormats = dateFormats
+	return o
+}
+
+// WithFieldDateFormats sets the date formats of particular
+// fields, replacing the date formats for those fields
+func (o QueryStringOptions) WithFieldDateFormats(fieldDateFormats map[string][]string) QueryStringOptions {
+	o.fieldDateFormats = fieldDateFormats
+	return o
+}
+
+// WithLocation sets the time zone of dates which don't specify
+// one, the default is UTC, date math is also rounded in this zone
+func (o QueryStringOptions) WithLocation(location *time.Location) QueryStringOptions {
+	o.location = location
+	return o
+}
+
+// WithKeywordOperators controls whether the words AND, OR and NOT
+// are treated as boolean operators, the symbolic forms &&, || and !
+// are always recognized
+func (o QueryStringOptions) WithKeywordOperators(enabled bool) QueryStringOptions {
+	o.keywordOperators = enabled
+	return o
+}
+
+// WithDefaultOperator sets how clauses without a + or - prefix
+// are combined, the default is OrOperator
+func (o QueryStringOptions) WithDefaultOperator(operator Operator) QueryStringOptions {
+	o.defaultOperator = operator
+	return o
+}
+
+// WithDefaultFields sets the fields searched by terms, phrases,
+// fuzzy terms and wildcards without a field, each field is
+// searched with its boost and any of them may match
+func (o QueryStringOptions) WithDefaultFields(fields map[string]float64) QueryStringOptions {
+	o.defaultFields = fields
+	return o
+}
+
+// WithMinimumShouldMatch sets how many of the should clauses of the
+// query and of each group must match, as an absolute number ("2"),
+// a percentage ("75%"), negative to count the clauses which need not
+// match ("-1", "-25%"), or conditional on the number of should
+// clauses ("3<90%", "2<-25% 9<-3")
+func (o QueryStringOptions) WithMinimumShouldMatch(spec string) QueryStringOptions {
+	o.minShouldMatch = spec
+	return o
+}
+
+// WithMinPrefixLength sets how many characters must precede the *
+// of a prefix term like mart*, shorter prefixes are rejected as
+// they match too many terms, as are patterns starting with * or ?
+func (o QueryStringOptions) WithMinPrefixLength(length int) QueryStringOptions {
+	o.minPrefixLength = length
+	return o
+}
+
+// WithNow sets the function returning the time date math
+// expressions like now-1d are relative to, the default is time.Now
+func (o QueryStringOptions) WithNow(now func() time.Time) QueryStringOptions {
+	o.now = now
+	return o
+}
+
+// WithOptimize controls whether the query is simplified before it
+// is returned, nested boolean queries are flattened, single clauses
+// unwrapped, duplicate clauses removed and required ranges of the
+// same field merged.  The simplified query matches the same
+// documents, though scores may differ.
+func (o QueryStringOptions) WithOptimize(enabled bool) QueryStringOptions {
+	o.optimize = enabled
+	return o
+}
+
+// WithPartialResults controls whether parsing a query string with
+// errors returns the query of the clauses which parsed together
+// with the errors, clauses with invalid values are left out and
+// invalid boosts are ignored
+func (o QueryStringOptions) WithPartialResults(enabled bool) QueryStringOptions {
+	o.partialResults = enabled
+	return o
+}
+
+// WithLenient controls whether query strings with errors are
+// changed so that they parse rather than rejected.  Stray operators
+// are dropped, unbalanced quotes and parens closed and invalid boosts
+// and fuzziness ignored, values which fail to parse are searched
+// as text.  ParseQueryStringWarnings returns the changes made.
+func (o QueryStringOptions) WithLenient(enabled bool) QueryStringOptions {
+	o.lenient = enabled
+	return o
+}
+
+// WithSimpleFlags sets the operators of the simple query string
+// syntax which are enabled, the default is SimpleAll, the runes
+// of disabled operators are searched as text
+func (o QueryStringOptions) WithSimpleFlags(flags SimpleFlags) QueryStringOptions {
+	o.simpleFlags = flags
 	return o
 }
 
@@ -70,23 +202,53 @@ func (o QueryStringOptions) WithLogger(logger *log.Logger) QueryStringOptions {
 }
 
 func ParseQueryString(query string, options QueryStringOptions) (rq bluge.Query, err error) {
+	if options.lenient {
+		rq, _, err = parseLenient(query, options)
+		return rq, err
+	}
 	if query == "" {
 		return bluge.NewMatchNoneQuery(), nil
 	}
-	lex := newLexerWrapper(newQueryStringLex(strings.NewReader(query), options), options)
-	doParse(lex)
-
-	if len(lex.errs) > 0 {
-		return nil, fmt.Errorf(strings.Join(lex.errs, "\n"))
+	minShould, err := parseMinimumShouldMatch(options.minShouldMatch)
+	if err != nil {
+		return nil, err
 	}
-	return lex.query, nil
+	root, err := ParseAST(query, options)
+	errs, _ := err.(ParseErrors)
+	if err != nil && !options.partialResults {
+		return nil, err
+	}
+	c := newCompiler(options, minShould)
+	rq, err = c.compileRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range c.errs {
+		err.locate(query)
+		errs = append(errs, err)
+	}
+	if options.optimize {
+		rq = optimizeQuery(rq)
+	}
+	if len(errs) > 0 {
+		errs.sort()
+		if !options.partialResults {
+			return nil, errs
+		}
+		return rq, errs
+	}
+	return rq, nil
 }
 
 func doParse(lex *lexerWrapper) {
 	defer func() {
+		// grammar actions stop parsing with a parse error,
+		// anything else is a bug and is left to panic
 		r := recover()
-		if r != nil {
-			lex.errs = append(lex.errs, fmt.Sprintf("parse error: %v", r))
+		if err, ok := r.(*ParseError); ok {
+			lex.errs = append(lex.errs, err)
+		} else if r != nil {
+			panic(r)
 		}
 	}()
 
@@ -99,31 +261,238 @@ const (
 	queryMustNot
 )
 
+// clause is a query together with the prefix
+// which decides how it joins the enclosing boolean query
+type clause struct {
+	prefix int
+	query  bluge.Query
+}
+
+// clauseQuery returns a query matching the same documents
+// as the clause does when it stands on its own
+func clauseQuery(c clause) bluge.Query {
+	if c.prefix == queryMustNot {
+		return bluge.NewBooleanQuery().AddMustNot(c.query)
+	}
+	return c.query
+}
+
+// queryStringOr joins the clauses of an OR expression into a
+// clause with the given prefix, a single clause is returned unchanged
+func queryStringOr(clauses []clause, prefix int) clause {
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+	bq := bluge.NewBooleanQuery()
+	for _, c := range clauses {
+		bq.AddShould(clauseQuery(c))
+	}
+	return clause{prefix: prefix, query: bq}
+}
+
+// queryStringAnd joins the clauses of an AND expression into a
+// clause with the given prefix, a single clause is returned unchanged
+func queryStringAnd(clauses []clause, prefix int) clause {
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+	bq := bluge.NewBooleanQuery()
+	for _, c := range clauses {
+		if c.prefix == queryMustNot {
+			bq.AddMustNot(c.query)
+		} else {
+			bq.AddMust(c.query)
+		}
+	}
+	return clause{prefix: prefix, query: bq}
+}
+
+func addClause(bq *bluge.BooleanQuery, c clause) *bluge.BooleanQuery {
+	switch c.prefix {
+	case queryShould:
+		bq.AddShould(c.query)
+	case queryMust:
+		bq.AddMust(c.query)
+	case queryMustNot:
+		bq.AddMustNot(c.query)
+	}
+	return bq
+}
+
 type lexerWrapper struct {
-	lex         yyLexer
-	errs        []string
-	query       *bluge.BooleanQuery
-	debugParser bool
-	dateFormat  string
-	logger      *log.Logger
+	lex              yyLexer
+	query            string
+	errs             []*ParseError
+	root             *Group
+	fields           []string
+	groupFields      []int
+	debugParser      bool
+	dateFormats      []string
+	fieldDateFormats map[string][]string
+	location         *time.Location
+	now              time.Time
+	logger           *log.Logger
+	// lenient parsing drops the unexpected tokens, its syntax
+	// errors don't name the tokens the parser expected
+	lenient bool
+
+	// tokens are the tokens read so far, numbered as in the parser
+	// tables, the last of them is from lastStart up to lastEnd
+	tokens    []int
+	lastStart int
+	lastEnd   int
+	// parens are the offsets of the parens left open, they
+	// are closed at the end of the query by added parens
+	parens    []int
+	atEOF     bool
+	addedLast bool
+	// recoveredAt is the number of tokens read when the
+	// parser last recovered from a syntax error
+	recoveredAt int
 }
 
-func newLexerWrapper(lex yyLexer, options QueryStringOptions) *lexerWrapper {
+func newLexerWrapper(lex yyLexer, query string, options QueryStringOptions) *lexerWrapper {
+	now := time.Now
+	if options.now != nil {
+		now = options.now
+	}
+	location := time.UTC
+	if options.location != nil {
+		location = options.location
+	}
 	return &lexerWrapper{
-		lex:         lex,
-		query:       bluge.NewBooleanQuery(),
-		debugParser: options.debugParser,
-		dateFormat:  options.dateFormat,
-		logger:      options.logger,
+		lex:              lex,
+		query:            query,
+		debugParser:      options.debugParser,
+		dateFormats:      options.dateFormats,
+		fieldDateFormats: options.fieldDateFormats,
+		location:         location,
+		now:              now(),
+		logger:           options.logger,
+		lenient:          options.lenient,
 	}
 }
 
 func (l *lexerWrapper) Lex(lval *yySymType) int {
-	return l.lex.Lex(lval)
+	rv := 0
+	if l.atEOF {
+		lval.start, lval.end = len(l.query), len(l.query)
+	} else {
+		rv = l.lex.Lex(lval)
+	}
+	l.addedLast = false
+
+	switch rv {
+	case tLPAREN:
+		l.parens = append(l.parens, lval.start)
+	case tRPAREN:
+		if len(l.parens) > 0 {
+			l.parens = l.parens[:len(l.parens)-1]
+		}
+	case 0:
+		l.atEOF = true
+		if len(l.parens) > 0 {
+			// close the group so that its clauses are kept
+			open := l.parens[len(l.parens)-1]
+			l.parens = l.parens[:len(l.parens)-1]
+			l.errorAt(open, open+1, fmt.Errorf("unclosed paren"))
+			l.addedLast = true
+			rv = tRPAREN
+		}
+	}
+
+	l.tokens = append(l.tokens, parserToken(rv))
+	l.lastStart, l.lastEnd = lval.start, lval.end
+	return rv
 }
 
+// Error records a syntax error at the last token read, the message
+// of the parser is replaced by one naming all the expected tokens
 func (l *lexerWrapper) Error(s string) {
-	l.errs = append(l.errs, s)
+	if l.recoveredAt == len(l.tokens) {
+		// the token of the last error, which is skipped
+		return
+	}
+	tokens := l.tokens
+	if l.addedLast {
+		// the parser didn't expect the end of the query
+		tokens = append(tokens[:len(tokens)-1:len(tokens)-1], yyEofCode)
+	}
+	l.errs = append(l.errs, syntaxError(tokens, l.lastStart, l.lastEnd, !l.lenient))
+}
+
+// errorAt records the error of the query string
+// text from byte offset start up to end
+func (l *lexerWrapper) errorAt(start, end int, err error) {
+	l.errs = append(l.errs, newParseError(start, end, err.Error()))
+}
+
+// badNode returns the node of a value which failed
+// to parse from byte offset start up to end
+func (l *lexerWrapper) badNode(start, end int) Node {
+	return withSpan(&Bad{Text: l.query[start:end]}, start, end)
+}
+
+// startGroup and endGroup enclose the clauses of a group,
+// the fields of clauses the parser skips after a syntax
+// error within the group are popped by recovered
+func (l *lexerWrapper) startGroup() {
+	l.groupFields = append(l.groupFields, len(l.fields))
+}
+
+func (l *lexerWrapper) endGroup() {
+	l.groupFields = l.groupFields[:len(l.groupFields)-1]
+}
+
+// recovered is called once the parser skipped the clause of a
+// syntax error and goes on parsing with the token of the error.
+// It reports whether that token failed again, which the parser
+// then skips, so that each error is reported once.
+func (l *lexerWrapper) recovered() bool {
+	depth := 0
+	if len(l.groupFields) > 0 {
+		depth = l.groupFields[len(l.groupFields)-1]
+	}
+	l.fields = l.fields[:depth]
+	again := l.recoveredAt == len(l.tokens)
+	l.recoveredAt = len(l.tokens)
+	return again
+}
+
+// pushField makes field the current field until the matching popField,
+// values without a field of their own are searched in the current field
+func (l *lexerWrapper) pushField(field string) {
+	l.fields = append(l.fields, field)
+}
+
+func (l *lexerWrapper) popField() {
+	l.fields = l.fields[:len(l.fields)-1]
+}
+
+func (l *lexerWrapper) field() string {
+	if len(l.fields) == 0 {
+		return ""
+	}
+	return l.fields[len(l.fields)-1]
+}
+
+// formatsOf returns the date formats of a field
+func (l *lexerWrapper) formatsOf(field string) []string {
+	if formats, ok := l.fieldDateFormats[field]; ok {
+		return formats
+	}
+	return l.dateFormats
+}
+
+// anchorParser returns the function parsing the dates of a field
+// which date math expressions are anchored at, in the default
+// time zone, telling these expressions from other strings
+func anchorParser(yylex yyLexer, field string) func(string) (time.Time, error) {
+	formats := yylex.(*lexerWrapper).formatsOf(field)
+	location := yylex.(*lexerWrapper).location
+	return func(t string) (time.Time, error) {
+		return parseTimeFormats(formats, t, location)
+	}
 }
 
 func (l *lexerWrapper) logDebugGrammarf(format string, v ...interface{}) {
@@ -132,79 +501,195 @@ func (l *lexerWrapper) logDebugGrammarf(format string, v ...interface{}) {
 	}
 }
 
-func queryTimeFromString(yylex yyLexer, t string) (time.Time, error) {
-	rv, err := time.Parse(yylex.(*lexerWrapper).dateFormat, t)
+// queryTimeFromString parses a date or a date math expression with
+// the date formats of the field, in the time zone of the bound if
+// it has one, roundUp decides the direction date math rounding goes
+func queryTimeFromString(yylex yyLexer, field string, bound rangeBound, roundUp bool) (time.Time, error) {
+	formats := yylex.(*lexerWrapper).formatsOf(field)
+	location := yylex.(*lexerWrapper).location
+	if bound.zone != "" {
+		var err error
+		location, err = time.LoadLocation(bound.zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone: %s", bound.zone)
+		}
+	}
+	parse := func(t string) (time.Time, error) {
+		return parseTimeFormats(formats, t, location)
+	}
+	if isDateMath(bound.value, parse) {
+		return parseDateMath(bound.value, yylex.(*lexerWrapper).now.In(location), parse, roundUp)
+	}
+	rv, err := parse(bound.value)
 	if err != nil {
 		return time.Time{}, err
 	}
 	return rv, nil
 }
 
-func queryStringStringToken(field, str string) bluge.Query {
-	if strings.HasPrefix(str, "/") && strings.HasSuffix(str, "/") {
-		return bluge.NewRegexpQuery(str[1 : len(str)-1]).SetField(field)
+// queryStringStringToken returns the node of a string, which is
+// a regexp between slashes, a wildcard or otherwise a term
+func queryStringStringToken(str string) Node {
+	if len(str) >= 2 && strings.HasPrefix(str, "/") && strings.HasSuffix(str, "/") {
+		return &Regexp{Pattern: str[1 : len(str)-1]}
 	} else if strings.ContainsAny(str, "*?") {
-		return bluge.NewWildcardQuery(str).SetField(field)
+		return &Wildcard{Pattern: str}
+	}
+	return &Term{Term: str}
+}
+
+// prefixOf returns the prefix of a term whose only wildcard
+// is a trailing *, such terms are cheaper to search as prefix
+func prefixOf(str string) (string, bool) {
+	prefix := strings.TrimSuffix(str, "*")
+	if prefix == "" || prefix == str || strings.ContainsAny(prefix, "*?") {
+		return "", false
 	}
-	return bluge.NewMatchQuery(str).SetField(field)
+	return prefix, true
 }
 
-func queryStringStringTokenFuzzy(field, str, fuzziness string) (*bluge.MatchQuery, error) {
+func queryStringStringTokenFuzzy(str, fuzziness string) (*Fuzzy, error) {
 	fuzzy, err := strconv.ParseFloat(fuzziness, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid fuzziness value: %v", err)
 	}
-	return bluge.NewMatchQuery(str).SetFuzziness(int(fuzzy)).SetField(field), nil
+	return &Fuzzy{Term: str, Fuzziness: int(fuzzy)}, nil
 }
 
-func queryStringNumberToken(field, str string) (bluge.Query, error) {
-	q1 := bluge.NewMatchQuery(str).SetField(field)
+func queryStringNumberToken(str string) (*Number, error) {
 	val, err := strconv.ParseFloat(str, 64)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing number: %v", err)
 	}
-	q2 := bluge.NewNumericRangeInclusiveQuery(val, val, true, true).SetField(field)
-	return bluge.NewBooleanQuery().AddShould([]bluge.Query{q1, q2}...), nil
+	return &Number{Text: str, Value: val}, nil
 }
 
-func queryStringPhraseToken(field, str string) *bluge.MatchPhraseQuery {
-	return bluge.NewMatchPhraseQuery(str).SetField(field)
+func queryStringPhraseToken(str string) *Phrase {
+	return &Phrase{Phrase: str}
 }
 
-func queryStringNumericRangeGreaterThanOrEqual(field, str string, orEqual bool) (*bluge.NumericRangeQuery, error) {
-	min, err := strconv.ParseFloat(str, 64)
+func queryStringPhraseTokenSlop(str, slop string) (*Phrase, error) {
+	dist, err := strconv.ParseFloat(slop, 64)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing number: %v", err)
+		return nil, fmt.Errorf("invalid slop value: %v", err)
+	} else if dist < 0 {
+		return nil, fmt.Errorf("invalid slop value: %s is negative", slop)
 	}
-	return bluge.NewNumericRangeInclusiveQuery(min, bluge.MaxNumeric, orEqual, true).
-		SetField(field), nil
+	return &Phrase{Phrase: str, Slop: int(dist)}, nil
 }
 
-func queryStringNumericRangeLessThanOrEqual(field, str string, orEqual bool) (*bluge.NumericRangeQuery, error) {
-	max, err := strconv.ParseFloat(str, 64)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing number: %v", err)
+// rangeBound is one end of a bracketed range, the
+// kind of token it was written as decides its type
+type rangeBound struct {
+	value   string
+	number  bool
+	phrase  bool
+	isoDate bool
+	zone    string
+}
+
+// openRangeBound leaves one end of a range unbounded
+var openRangeBound = rangeBound{value: "*"}
+
+// open reports whether the bound is a * leaving that end unbounded
+func (b rangeBound) open() bool {
+	return !b.phrase && b.value == "*"
+}
+
+// date reports whether the bound may be a date, ISO dates and
+// date math expressions are dates even when they aren't quoted,
+// parseAnchor parses the dates date math is anchored at
+func (b rangeBound) date(parseAnchor func(string) (time.Time, error)) bool {
+	return b.phrase || b.isoDate || b.open() || isDateMath(b.value, parseAnchor)
+}
+
+// mustBeDate reports whether the bound is written as a date, so
+// that failing to parse it is an error rather than a term range
+func (b rangeBound) mustBeDate(parseAnchor func(string) (time.Time, error)) bool {
+	return b.isoDate || b.zone != "" || isDateMath(b.value, parseAnchor)
+}
+
+func queryStringRange(yylex yyLexer, field string, min, max rangeBound, minInclusive, maxInclusive bool) (Node, error) {
+	if min.open() && max.open() {
+		return nil, fmt.Errorf("range must specify min or max")
+	}
+	if (min.number || min.open()) && (max.number || max.open()) {
+		return queryStringNumericRange(min, max, minInclusive, maxInclusive)
 	}
-	return bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, max, true, orEqual).
-		SetField(field), nil
+	parseAnchor := anchorParser(yylex, field)
+	if min.date(parseAnchor) && max.date(parseAnchor) {
+		q, err := queryStringDateRange(yylex, field, min, max, minInclusive, maxInclusive)
+		if err == nil {
+			return q, nil
+		} else if min.mustBeDate(parseAnchor) || max.mustBeDate(parseAnchor) {
+			return nil, err
+		}
+		// phrases which aren't dates are compared as terms
+	}
+	return queryStringTermRange(min, max, minInclusive, maxInclusive), nil
 }
 
-func queryStringDateRangeGreaterThanOrEqual(yylex yyLexer, field, phrase string, orEqual bool) (*bluge.DateRangeQuery, error) {
-	minTime, err := queryTimeFromString(yylex, phrase)
-	if err != nil {
-		return nil, fmt.Errorf("invalid time: %v", err)
+func queryStringNumericRange(min, max rangeBound, minInclusive, maxInclusive bool) (*NumericRange, error) {
+	rv := &NumericRange{MinInclusive: minInclusive, MaxInclusive: maxInclusive}
+	if min.open() {
+		rv.MinInclusive = true
+	} else {
+		minVal, err := strconv.ParseFloat(min.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing number: %v", err)
+		}
+		rv.Min = &minVal
 	}
-	return bluge.NewDateRangeInclusiveQuery(minTime, time.Time{}, orEqual, true).
-		SetField(field), nil
+	if max.open() {
+		rv.MaxInclusive = true
+	} else {
+		maxVal, err := strconv.ParseFloat(max.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing number: %v", err)
+		}
+		rv.Max = &maxVal
+	}
+	return rv, nil
 }
 
-func queryStringDateRangeLessThanOrEqual(yylex yyLexer, field, phrase string, orEqual bool) (*bluge.DateRangeQuery, error) {
-	maxTime, err := queryTimeFromString(yylex, phrase)
-	if err != nil {
-		return nil, fmt.Errorf("invalid time: %v", err)
+func queryStringDateRange(yylex yyLexer, field string, min, max rangeBound,
+	minInclusive, maxInclusive bool) (*DateRange, error) {
+	rv := &DateRange{MinInclusive: minInclusive, MaxInclusive: maxInclusive}
+	var err error
+	if min.open() {
+		rv.MinInclusive = true
+	} else {
+		rv.Min.Time, err = queryTimeFromString(yylex, field, min, !minInclusive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time: %v", err)
+		}
+		rv.Min.Value, rv.Min.Zone = min.value, min.zone
+	}
+	if max.open() {
+		rv.MaxInclusive = true
+	} else {
+		rv.Max.Time, err = queryTimeFromString(yylex, field, max, maxInclusive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time: %v", err)
+		}
+		rv.Max.Value, rv.Max.Zone = max.value, max.zone
+	}
+	return rv, nil
+}
+
+func queryStringTermRange(min, max rangeBound, minInclusive, maxInclusive bool) *TermRange {
+	rv := &TermRange{MinInclusive: minInclusive, MaxInclusive: maxInclusive}
+	if min.open() {
+		rv.MinInclusive = true
+	} else {
+		rv.Min = min.value
+	}
+	if max.open() {
+		rv.MaxInclusive = true
+	} else {
+		rv.Max = max.value
 	}
-	return bluge.NewDateRangeInclusiveQuery(time.Time{}, maxTime, true, orEqual).
-		SetField(field), nil
+	return rv
 }
 
 const noBoost = 1.0
@@ -225,6 +710,8 @@ func queryStringSetBoost(q bluge.Query, b float64) (bluge.Query, error) {
 		return v.SetBoost(b), nil
 	case *bluge.WildcardQuery:
 		return v.SetBoost(b), nil
+	case *bluge.PrefixQuery:
+		return v.SetBoost(b), nil
 	case *bluge.BooleanQuery:
 		return v.SetBoost(b), nil
 	case *bluge.NumericRangeQuery:
@@ -233,6 +720,16 @@ func queryStringSetBoost(q bluge.Query, b float64) (bluge.Query, error) {
 		return v.SetBoost(b), nil
 	case *bluge.DateRangeQuery:
 		return v.SetBoost(b), nil
+	case *bluge.TermRangeQuery:
+		return v.SetBoost(b), nil
+	case *ExistsQuery:
+		return v.SetBoost(b), nil
+	case *bluge.GeoDistanceQuery:
+		return v.SetBoost(b), nil
+	case *bluge.GeoBoundingBoxQuery:
+		return v.SetBoost(b), nil
+	case *bluge.GeoBoundingPolygonQuery:
+		return v.SetBoost(b), nil
 	}
 	return nil, fmt.Errorf("cannot boost %T", q)
 }
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/numeric/geo"
 )
 
 func TestQuerySyntaxParserValid(t *testing.T) {
@@ -47,6 +48,18 @@ func TestQuerySyntaxParserValid(t *testing.T) {
 			result: bluge.NewBooleanQuery().
 				AddShould(bluge.NewMatchPhraseQuery("test phrase 1")),
 		},
+		{
+			input: `"test phrase 1" @marty`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchPhraseQuery("test phrase 1")).
+				AddShould(bluge.NewMatchQuery("@marty")),
+		},
+		{
+			input: `"2024-05-01"@UTC`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchPhraseQuery("2024-05-01")).
+				AddShould(bluge.NewMatchQuery("@UTC")),
+		},
 		{
 			input: "field:test",
 			result: bluge.NewBooleanQuery().
@@ -178,6 +191,11 @@ func TestQuerySyntaxParserValid(t *testing.T) {
 						SetFuzziness(1).
 						SetField("field")),
 		},
+		{
+			input: "watex~2^3",
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("watex").SetFuzziness(2).SetBoost(3.0)),
+		},
 		{
 			input: "field:watex~2",
 			result: bluge.NewBooleanQuery().
@@ -277,6 +295,61 @@ func TestQuerySyntaxParserValid(t *testing.T) {
 				AddShould(bluge.NewDateRangeInclusiveQuery(time.Time{}, theDate, true, true).
 					SetField("field")),
 		},
+		{
+			input: `field:>2006-01-02T15:04:05Z`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(theDate, time.Time{}, false, true).
+					SetField("field")),
+		},
+		{
+			input: `field:<=2006-01-02T10:04:05-05:00 other`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Time{}, time.Date(2006, 1, 2, 10, 4, 5, 0, time.FixedZone("", -5*60*60)), true, true).
+					SetField("field")).
+				AddShould(bluge.NewMatchQuery("other")),
+		},
+		{
+			input: `field:[2006-01-02 TO 2006-01-02T15:04:05.000]`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), theDate, true, true).
+					SetField("field")),
+		},
+		{
+			input: `field:{2006-01-02T15:04 TO *}`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC), time.Time{}, false, true).
+					SetField("field")),
+		},
+		{
+			input: `field:2006-01-02`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("2006-01-02").
+					SetField("field")),
+		},
+		{
+			input: `field:>="2006-01-02"`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), time.Time{}, true, true).
+					SetField("field")),
+		},
+		{
+			input: `field:<"Mon, 02 Jan 2006 15:04:05 UTC"`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(time.Time{}, theDate, true, false).
+					SetField("field")),
+		},
+		{
+			input: `zip:>="02134" sku:["100" TO "200"]`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("02134", "", true, true).
+					SetField("zip")).
+				AddShould(bluge.NewTermRangeInclusiveQuery("100", "200", true, true).
+					SetField("sku")),
+		},
 		{
 			input: `/mar.*ty/`,
 			result: bluge.NewBooleanQuery().
@@ -291,14 +364,466 @@ func TestQuerySyntaxParserValid(t *testing.T) {
 		{
 			input: `mart*`,
 			result: bluge.NewBooleanQuery().
-				AddShould(bluge.NewWildcardQuery("mart*")),
+				AddShould(bluge.NewPrefixQuery("mart")),
 		},
 		{
 			input: `name:mart*`,
 			result: bluge.NewBooleanQuery().
-				AddShould(bluge.NewWildcardQuery("mart*").
+				AddShould(bluge.NewPrefixQuery("mart").
+					SetField("name")),
+		},
+		{
+			input: `name:mar*y^2`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewWildcardQuery("mar*y").
+					SetField("name").
+					SetBoost(2.0)),
+		},
+		{
+			input: `m?rt*`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewWildcardQuery("m?rt*")),
+		},
+		{
+			input: `mart**`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewWildcardQuery("mart**")),
+		},
+		{
+			input: `*`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewWildcardQuery("*")),
+		},
+		{
+			input: `name:/(mar|mor).*ty/`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewRegexpQuery("(mar|mor).*ty").
 					SetField("name")),
 		},
+		{
+			input: `/a b/^2 c`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewRegexpQuery("a b").
+					SetBoost(2.0)).
+				AddShould(bluge.NewMatchQuery("c")),
+		},
+		{
+			input: `url:/usr/bin`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("/usr/bin").
+					SetField("url")),
+		},
+		{
+			input: `a /re`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("/re")),
+		},
+		{
+			input: `/`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("/")),
+		},
+		{
+			input: `f:/`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("/").
+					SetField("f")),
+		},
+
+		// tests for grouping
+		{
+			input: `(test)`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("test"))),
+		},
+		{
+			input: `+(title:go body:golang) -status:draft`,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("go").SetField("title")).
+					AddShould(bluge.NewMatchQuery("golang").SetField("body"))).
+				AddMustNot(bluge.NewMatchQuery("draft").SetField("status")),
+		},
+		{
+			input: `(+cat -dog)^3 mouse`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddMust(bluge.NewMatchQuery("cat")).
+					AddMustNot(bluge.NewMatchQuery("dog")).
+					SetBoost(3.0)).
+				AddShould(bluge.NewMatchQuery("mouse")),
+		},
+		{
+			input: `-(a (b c^2))`,
+			result: bluge.NewBooleanQuery().
+				AddMustNot(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("a")).
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewMatchQuery("b")).
+						AddShould(bluge.NewMatchQuery("c").SetBoost(2.0)))),
+		},
+		{
+			input: `(field:33 watex~)`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewMatchQuery("33").SetField("field")).
+						AddShould(
+							bluge.NewNumericRangeInclusiveQuery(33.0, 33.0,
+								true, true).
+								SetField("field"))).
+					AddShould(bluge.NewMatchQuery("watex").SetFuzziness(1))),
+		},
+
+		// tests for boolean operators
+		{
+			input: `cat AND dog`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddMust(bluge.NewMatchQuery("cat")).
+					AddMust(bluge.NewMatchQuery("dog"))),
+		},
+		{
+			input: `cat && dog || mouse`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddMust(bluge.NewMatchQuery("cat")).
+						AddMust(bluge.NewMatchQuery("dog"))).
+					AddShould(bluge.NewMatchQuery("mouse"))),
+		},
+		{
+			input: `cat OR dog AND mouse OR bird`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("cat")).
+					AddShould(bluge.NewBooleanQuery().
+						AddMust(bluge.NewMatchQuery("dog")).
+						AddMust(bluge.NewMatchQuery("mouse"))).
+					AddShould(bluge.NewMatchQuery("bird"))),
+		},
+		{
+			input: `cat AND NOT dog`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddMust(bluge.NewMatchQuery("cat")).
+					AddMustNot(bluge.NewMatchQuery("dog"))),
+		},
+		{
+			input: `NOT cat OR !dog`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddMustNot(bluge.NewMatchQuery("cat"))).
+					AddShould(bluge.NewBooleanQuery().
+						AddMustNot(bluge.NewMatchQuery("dog")))),
+		},
+		{
+			input: `+(title:go OR body:golang) NOT(status:draft)`,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewMatchQuery("go").SetField("title")).
+						AddShould(bluge.NewMatchQuery("golang").SetField("body")))).
+				AddMustNot(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("draft").SetField("status"))),
+		},
+		{
+			input: `x +a OR b`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("x")).
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("a")).
+					AddShould(bluge.NewMatchQuery("b"))),
+		},
+		{
+			input: `x +a AND b`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("x")).
+				AddMust(bluge.NewBooleanQuery().
+					AddMust(bluge.NewMatchQuery("a")).
+					AddMust(bluge.NewMatchQuery("b"))),
+		},
+		{
+			input: `x +a AND b OR c -d AND e`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("x")).
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddMust(bluge.NewMatchQuery("a")).
+						AddMust(bluge.NewMatchQuery("b"))).
+					AddShould(bluge.NewMatchQuery("c"))).
+				AddShould(bluge.NewBooleanQuery().
+					AddMustNot(bluge.NewMatchQuery("d")).
+					AddMust(bluge.NewMatchQuery("e"))),
+		},
+		// operators are case sensitive
+		{
+			input: `cat and dog`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("cat")).
+				AddShould(bluge.NewMatchQuery("and")).
+				AddShould(bluge.NewMatchQuery("dog")),
+		},
+		// a single & or | is part of a term
+		{
+			input: `&cat |dog`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("&cat")).
+				AddShould(bluge.NewMatchQuery("|dog")),
+		},
+		// keywords used as field names are not operators
+		{
+			input: `AND:cat`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("cat").SetField("AND")),
+		},
+
+		// tests for bracketed ranges
+		{
+			input: `field:[5 TO 10]`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(5.0, 10.0, true, true).
+					SetField("field")),
+		},
+		{
+			input: `field:{5 TO 10}`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(5.0, 10.0, false, false).
+					SetField("field")),
+		},
+		{
+			input: `field:[-5.5 TO 10}`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(-5.5, 10.0, true, false).
+					SetField("field")),
+		},
+		{
+			input: `field:{5 TO *]`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(5.0, bluge.MaxNumeric, false, true).
+					SetField("field")),
+		},
+		{
+			input: `field:[* TO -5}^2`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, -5.0, true, false).
+					SetField("field").
+					SetBoost(2.0)),
+		},
+		{
+			input: `field:["2006-01-02T15:04:05Z" TO "2006-01-02T15:04:05Z"}`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(theDate, theDate, true, false).
+					SetField("field")),
+		},
+		{
+			input: `+field:{"2006-01-02T15:04:05Z" TO *] -other:TO`,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewDateRangeInclusiveQuery(theDate, time.Time{}, false, true).
+					SetField("field")).
+				AddMustNot(bluge.NewMatchQuery("TO").SetField("other")),
+		},
+
+		// tests for term ranges
+		{
+			input: `sku:>=A100`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("A100", "", true, true).
+					SetField("sku")),
+		},
+		{
+			input: `sku:<A100`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("", "A100", true, false).
+					SetField("sku")),
+		},
+		{
+			input: `name:[alice TO bob]`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("alice", "bob", true, true).
+					SetField("name")),
+		},
+		{
+			input: `name:{alice TO *]`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("alice", "", false, true).
+					SetField("name")),
+		},
+		// bounds which only look like date math are terms
+		{
+			input: `name:>nowak`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("nowak", "", false, true).
+					SetField("name")),
+		},
+		{
+			input: `name:>=a||b`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("a||b", "", true, true).
+					SetField("name")),
+		},
+		// quoted bounds which aren't dates fall back to terms
+		{
+			input: `name:>"van der berg"`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("van der berg", "", false, true).
+					SetField("name")),
+		},
+		{
+			input: `name:["2006-01-02T15:04:05Z" TO "zzz"}`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("2006-01-02T15:04:05Z", "zzz", true, false).
+					SetField("name")),
+		},
+		// mixed numbers and terms compare as terms
+		{
+			input: `code:[5 TO abc]`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("5", "abc", true, true).
+					SetField("code")),
+		},
+
+		// tests for sloppy phrases
+		{
+			input: `"quick fox"~3`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchPhraseQuery("quick fox").SetSlop(3)),
+		},
+		{
+			input: `"quick fox"~`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchPhraseQuery("quick fox").SetSlop(1)),
+		},
+		{
+			input: `+body:"quick fox"~2^4`,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchPhraseQuery("quick fox").
+					SetField("body").
+					SetSlop(2).
+					SetBoost(4.0)),
+		},
+		{
+			input: `("quick fox"~5)`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchPhraseQuery("quick fox").SetSlop(5))),
+		},
+
+		// tests for field scoped groups
+		{
+			input: `tag:(go rust "zig lang")`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("go").SetField("tag")).
+					AddShould(bluge.NewMatchQuery("rust").SetField("tag")).
+					AddShould(bluge.NewMatchPhraseQuery("zig lang").SetField("tag"))),
+		},
+		{
+			input: `+tag:(+go^2 -rus* zig~ title:other)^3 after`,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddMust(bluge.NewMatchQuery("go").SetField("tag").SetBoost(2.0)).
+					AddMustNot(bluge.NewPrefixQuery("rus").SetField("tag")).
+					AddShould(bluge.NewMatchQuery("zig").SetField("tag").SetFuzziness(1)).
+					AddShould(bluge.NewMatchQuery("other").SetField("title")).
+					SetBoost(3.0)).
+				AddShould(bluge.NewMatchQuery("after")),
+		},
+		{
+			input: `price:(>=5 AND <10 OR [20 TO 30])`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewBooleanQuery().
+							AddMust(bluge.NewNumericRangeInclusiveQuery(5.0, bluge.MaxNumeric, true, true).
+								SetField("price")).
+							AddMust(bluge.NewNumericRangeInclusiveQuery(bluge.MinNumeric, 10.0, true, false).
+								SetField("price"))).
+						AddShould(bluge.NewNumericRangeInclusiveQuery(20.0, 30.0, true, true).
+							SetField("price")))),
+		},
+		{
+			input: `a:(b:(/c.*/) 5)`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewRegexpQuery("c.*").SetField("b"))).
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewMatchQuery("5").SetField("a")).
+						AddShould(bluge.NewNumericRangeInclusiveQuery(5.0, 5.0, true, true).
+							SetField("a")))),
+		},
+		{
+			input: `>5`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewNumericRangeInclusiveQuery(5.0, bluge.MaxNumeric, false, true)),
+		},
+
+		// tests for field existence
+		{
+			input: `_exists_:email`,
+			result: bluge.NewBooleanQuery().
+				AddShould(NewExistsQuery("email")),
+		},
+		{
+			input: `-_exists_:email`,
+			result: bluge.NewBooleanQuery().
+				AddMustNot(NewExistsQuery("email")),
+		},
+		{
+			input: `email:*`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewWildcardQuery("*").SetField("email")),
+		},
+		{
+			input: `+_exists_:(email phone^2)`,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(NewExistsQuery("email")).
+					AddShould(NewExistsQuery("phone").SetBoost(2.0))),
+		},
+
+		// tests for geo functions
+		{
+			input: `location:near(37.77,-122.41,5km)`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewGeoDistanceQuery(-122.41, 37.77, "5km").
+					SetField("location")),
+		},
+		{
+			input: `+location:near(37.77, -122.41, 2.5mi)^2 pizza`,
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewGeoDistanceQuery(-122.41, 37.77, "2.5mi").
+					SetField("location").
+					SetBoost(2.0)).
+				AddShould(bluge.NewMatchQuery("pizza")),
+		},
+		{
+			input: `near(0,0,100ft) nearby`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewGeoDistanceQuery(0, 0, "100ft")).
+				AddShould(bluge.NewMatchQuery("nearby")),
+		},
+		{
+			input: `location:bbox(37.8,-122.5,37.7,-122.3)`,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewGeoBoundingBoxQuery(-122.5, 37.8, -122.3, 37.7).
+					SetField("location")),
+		},
+		{
+			input: `-location:polygon((37.8 -122.5), (37.7 -122.5),(37.7 -122.3),(37.8 -122.5))^3`,
+			result: bluge.NewBooleanQuery().
+				AddMustNot(bluge.NewGeoBoundingPolygonQuery([]geo.Point{
+					{Lat: 37.8, Lon: -122.5},
+					{Lat: 37.7, Lon: -122.5},
+					{Lat: 37.7, Lon: -122.3},
+				}).
+					SetField("location").
+					SetBoost(3.0)),
+		},
 
 		// tests for escaping
 
@@ -392,10 +917,6 @@ func TestQuerySyntaxParserInvalid(t *testing.T) {
 		{"^5"},
 		{"field:-text"},
 		{"field:+text"},
-		{"field:>text"},
-		{"field:>=text"},
-		{"field:<text"},
-		{"field:<=text"},
 		{"field:~text"},
 		{"field:^text"},
 		{"field::text"},
@@ -404,12 +925,61 @@ func TestQuerySyntaxParserInvalid(t *testing.T) {
 		{`cat^3\0`},
 		{`cat~3\:`},
 		{`cat~3\0`},
+		{`"cat dog"~x`},
+		{`field:"cat dog"~3\:`},
 		{strings.Repeat(`9`, 369)},
 		{`field:` + strings.Repeat(`9`, 369)},
 		{`field:>` + strings.Repeat(`9`, 369)},
 		{`field:>=` + strings.Repeat(`9`, 369)},
 		{`field:<` + strings.Repeat(`9`, 369)},
 		{`field:<=` + strings.Repeat(`9`, 369)},
+		{"(test"},
+		{"test)"},
+		{"()"},
+		{"+()"},
+		{"field:()"},
+		{"field:(test"},
+		{"field:-(test)"},
+		{"AND"},
+		{"cat AND"},
+		{"OR dog"},
+		{"cat || || dog"},
+		{"cat NOT"},
+		{"field:AND"},
+		{"field:[5 TO 10"},
+		{"field:[5 10]"},
+		{"field:[* TO *]"},
+		{"field:>*"},
+		{"location:near(91,0,5km)"},
+		{"location:near(0,-181,5km)"},
+		{"location:near(NaN,0,5km)"},
+		{"location:near(0,0)"},
+		{"location:near(0,0,5km,1)"},
+		{"location:near(0,0,-5km)"},
+		{"location:near(0,0,5parsecs)"},
+		{"location:near(0,0,5km"},
+		{"location:bbox(37.8,-122.5,37.7)"},
+		{"location:bbox(37.7,-122.5,37.8,-122.3)"},
+		{"location:bbox(37.8,-122.5,37.7,-190)"},
+		{"location:polygon((0 0),(1 1),(0 0))"},
+		{"location:polygon((1 1),(1 1),(1 1),(1 1))"},
+		{"location:polygon((0 0),(1 1),(0 0),(0 0))"},
+		{"location:polygon((0 0),(1 1),(1 0),(0 1))"},
+		{"location:polygon((0 0),(1 1),(1 0),0 0)"},
+		{"location:polygon((0 0),(1 1 1),(1 0),(0 0))"},
+		{"location:polygon((0 0),(100 1),(1 0),(0 0))"},
+		{"location:polygon((0 0),(1 (1)),(1 0),(0 0))"},
+		{"location:polygon((0 0),(1 1),(1 0),(0 0)"},
+		{"location:polygon((0 0),(1 1),(1 0),(0 0"},
+		{"created:>now-1x"},
+		{"created:>2024-02-30"},
+		{"created:>2024-05-01T25:00"},
+		{`created:>"2024-05-01"@Mars/Olympus_Mons`},
+		{`created:>"2024-05-01"@`},
+		{`created:>"big"@UTC`},
+		{"created:[now/q TO *]"},
+		{`created:>"2024-05-01T00:00:00Z||+1q"`},
+		{"field:[5 TO " + strings.Repeat(`9`, 369) + "]"},
 	}
 
 	for _, test := range tests {
@@ -420,6 +990,292 @@ func TestQuerySyntaxParserInvalid(t *testing.T) {
 	}
 }
 
+func TestQuerySyntaxParserKeywordOperatorsDisabled(t *testing.T) {
+	options := DefaultOptions().WithKeywordOperators(false)
+	q, err := ParseQueryString(`cat AND dog && NOT mouse`, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := bluge.NewBooleanQuery().
+		AddShould(bluge.NewMatchQuery("cat")).
+		AddShould(bluge.NewMatchQuery("AND")).
+		AddShould(bluge.NewBooleanQuery().
+			AddMust(bluge.NewMatchQuery("dog")).
+			AddMust(bluge.NewMatchQuery("NOT"))).
+		AddShould(bluge.NewMatchQuery("mouse"))
+	if !reflect.DeepEqual(q, expect) {
+		t.Errorf("Expected %#v, got %#v", expect, q)
+	}
+}
+
+func TestQuerySyntaxParserWithOptions(t *testing.T) {
+	theDate, err := time.Parse(time.RFC3339, "2006-01-02T15:04:05Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a wednesday
+	theNow := time.Date(2024, 5, 15, 10, 30, 45, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input   string
+		options QueryStringOptions
+		result  bluge.Query
+	}{
+		{
+			input:   `red shoes -used`,
+			options: DefaultOptions().WithDefaultOperator(AndOperator),
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("red")).
+				AddMust(bluge.NewMatchQuery("shoes")).
+				AddMustNot(bluge.NewMatchQuery("used")),
+		},
+		{
+			input:   `red OR blue shoes`,
+			options: DefaultOptions().WithDefaultOperator(AndOperator),
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("red")).
+					AddShould(bluge.NewMatchQuery("blue"))).
+				AddMust(bluge.NewMatchQuery("shoes")),
+		},
+		{
+			input:   `(red blue) shoes`,
+			options: DefaultOptions().WithDefaultOperator(AndOperator),
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewBooleanQuery().
+					AddMust(bluge.NewMatchQuery("red")).
+					AddMust(bluge.NewMatchQuery("blue"))).
+				AddMust(bluge.NewMatchQuery("shoes")),
+		},
+		{
+			input: `red "running shoes"~2 sho*^3 color:blue`,
+			options: DefaultOptions().WithDefaultFields(map[string]float64{
+				"title":       2,
+				"description": 1,
+			}),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("red").SetField("description")).
+					AddShould(bluge.NewMatchQuery("red").SetField("title").SetBoost(2.0))).
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchPhraseQuery("running shoes").SetField("description").SetSlop(2)).
+					AddShould(bluge.NewMatchPhraseQuery("running shoes").SetField("title").SetSlop(2).SetBoost(2.0))).
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewPrefixQuery("sho").SetField("description")).
+					AddShould(bluge.NewPrefixQuery("sho").SetField("title").SetBoost(2.0)).
+					SetBoost(3.0)).
+				AddShould(bluge.NewMatchQuery("blue").SetField("color")),
+		},
+		{
+			input:   `red~ tag:(blue green)`,
+			options: DefaultOptions().WithDefaultFields(map[string]float64{"title": 1.5}),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("red").SetField("title").SetFuzziness(1).SetBoost(1.5)).
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("blue").SetField("tag")).
+					AddShould(bluge.NewMatchQuery("green").SetField("tag"))),
+		},
+		{
+			input:   `red^2 "running shoes"^0.5 tag:blue^3`,
+			options: DefaultOptions().WithDefaultFields(map[string]float64{"title": 1.5}),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("red").SetField("title").SetBoost(3.0)).
+				AddShould(bluge.NewMatchPhraseQuery("running shoes").SetField("title").SetBoost(0.75)).
+				AddShould(bluge.NewMatchQuery("blue").SetField("tag").SetBoost(3.0)),
+		},
+		{
+			input:   `+required a b (c d e f)`,
+			options: DefaultOptions().WithMinimumShouldMatch("75%"),
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("required")).
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")).
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("c")).
+					AddShould(bluge.NewMatchQuery("d")).
+					AddShould(bluge.NewMatchQuery("e")).
+					AddShould(bluge.NewMatchQuery("f")).
+					SetMinShould(3)).
+				SetMinShould(2),
+		},
+		{
+			input:   `mar* m*t`,
+			options: DefaultOptions().WithMinPrefixLength(3),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewPrefixQuery("mar")).
+				AddShould(bluge.NewWildcardQuery("m*t")),
+		},
+		{
+			input:   `a b (c d e) -f`,
+			options: DefaultOptions().WithMinimumShouldMatch("2<-1"),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddShould(bluge.NewMatchQuery("b")).
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("c")).
+					AddShould(bluge.NewMatchQuery("d")).
+					AddShould(bluge.NewMatchQuery("e")).
+					SetMinShould(2)).
+				AddMustNot(bluge.NewMatchQuery("f")).
+				SetMinShould(2),
+		},
+		{
+			input:   `created:>now-24h`,
+			options: DefaultOptions().WithNow(func() time.Time { return theNow }),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(theNow.Add(-24*time.Hour), time.Time{}, false, true).
+					SetField("created")),
+		},
+		{
+			input:   `created:[now-1M/M TO now/M}`,
+			options: DefaultOptions().WithNow(func() time.Time { return theNow }),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+					time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), true, false).
+					SetField("created")),
+		},
+		{
+			input:   `created:{now/d TO now/d]`,
+			options: DefaultOptions().WithNow(func() time.Time { return theNow }),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2024, 5, 15, 23, 59, 59, 999000000, time.UTC),
+					time.Date(2024, 5, 15, 23, 59, 59, 999000000, time.UTC), false, true).
+					SetField("created")),
+		},
+		{
+			input:   `created:<="2024-01-01T00:00:00Z||+1M/M" created:>=now/w`,
+			options: DefaultOptions().WithNow(func() time.Time { return theNow }),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Time{}, time.Date(2024, 2, 29, 23, 59, 59, 999000000, time.UTC), true, true).
+					SetField("created")).
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), time.Time{}, true, true).
+					SetField("created")),
+		},
+		{
+			input:   `field:>"02/01/2006"`,
+			options: DefaultOptions().WithDateFormats("02/01/2006", time.RFC3339),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), time.Time{}, false, true).
+					SetField("field")),
+		},
+		{
+			input:   `field:["1136214245" TO "1136214245000"]`,
+			options: DefaultOptions().WithDateFormats(EpochSeconds, EpochMillis),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(theDate, theDate, true, true).
+					SetField("field")),
+		},
+		{
+			input: `created:>"1136214245000" updated:>"1136214245000"`,
+			options: DefaultOptions().WithFieldDateFormats(map[string][]string{
+				"created": {time.RFC3339},
+				"updated": {EpochMillis},
+			}),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewTermRangeInclusiveQuery("1136214245000", "", false, true).
+					SetField("created")).
+				AddShould(bluge.NewDateRangeInclusiveQuery(theDate, time.Time{}, false, true).
+					SetField("updated")),
+		},
+		{
+			input:   `created:>="2024-05-01" updated:<"2024-05-01T12:00:00Z"`,
+			options: DefaultOptions().WithLocation(newYork),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2024, 5, 1, 0, 0, 0, 0, newYork), time.Time{}, true, true).
+					SetField("created")).
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Time{}, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), true, false).
+					SetField("updated")),
+		},
+		{
+			input:   `created:>="2024-05-01"@America/New_York`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2024, 5, 1, 0, 0, 0, 0, newYork), time.Time{}, true, true).
+					SetField("created")),
+		},
+		{
+			input:   `created:>=2024-05-01@America/New_York`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2024, 5, 1, 0, 0, 0, 0, newYork), time.Time{}, true, true).
+					SetField("created")),
+		},
+		{
+			input:   `created:["now/d"@America/New_York TO "2024-05-16"]`,
+			options: DefaultOptions().WithNow(func() time.Time { return theNow }),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewDateRangeInclusiveQuery(
+					time.Date(2024, 5, 15, 0, 0, 0, 0, newYork),
+					time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC), true, true).
+					SetField("created")),
+		},
+	}
+
+	for _, test := range tests {
+		q, err := ParseQueryString(test.input, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(q, test.result) {
+			t.Errorf("Expected %#v, got %#v: for %s", test.result, q, test.input)
+		}
+	}
+}
+
+func TestQuerySyntaxParserMinPrefixLength(t *testing.T) {
+	_, err := ParseQueryString("name:ma*", DefaultOptions().WithMinPrefixLength(3))
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestQuerySyntaxParserInvalidMinimumShouldMatch(t *testing.T) {
+	_, err := ParseQueryString("a b", DefaultOptions().WithMinimumShouldMatch("most"))
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestQuerySyntaxParserInvalidDateFormats(t *testing.T) {
+	_, err := ParseQueryString(`field:>"yesterday"@UTC`,
+		DefaultOptions().WithDateFormats(time.RFC3339, EpochSeconds))
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	for _, format := range []string{time.RFC3339, EpochSeconds} {
+		if !strings.Contains(err.Error(), format) {
+			t.Errorf("expected error to list format %s, got: %v", format, err)
+		}
+	}
+}
+
+func TestQuerySyntaxParserLongRegexp(t *testing.T) {
+	// longer than the buffer of the lexer
+	pattern := strings.Repeat("a b.", 2000)
+	q, err := ParseQueryString("/"+pattern+"/ b", DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bluge.NewBooleanQuery().
+		AddShould(bluge.NewRegexpQuery(pattern)).
+		AddShould(bluge.NewMatchQuery("b"))
+	if !reflect.DeepEqual(q, expected) {
+		t.Errorf("expected %#v, got %#v", expected, q)
+	}
+}
+
 var extTokenTypes []int
 var extTokens []yySymType
 
@@ -428,8 +1284,7 @@ func BenchmarkLexer(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		var tokenTypes []int
 		var tokens []yySymType
-		r := strings.NewReader(`+field4:"test phrase 1"`)
-		l := newQueryStringLex(r, DefaultOptions())
+		l := newQueryStringLex(`+field4:"test phrase 1"`, DefaultOptions())
 		var lval yySymType
 		rv := l.Lex(&lval)
 		for rv > 0 {
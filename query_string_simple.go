@@ -0,0 +1,245 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/blugelabs/bluge"
+)
+
+// SimpleFlags are the operators of the simple query string syntax
+type SimpleFlags int
+
+const (
+	// SimpleAnd enables + requiring a clause
+	SimpleAnd SimpleFlags = 1 << iota
+	// SimpleOr enables | between clauses any of which may match
+	SimpleOr
+	// SimpleNot enables - excluding a clause
+	SimpleNot
+	// SimplePhrase enables quoted phrases
+	SimplePhrase
+	// SimplePrefix enables prefix terms like mart*
+	SimplePrefix
+	// SimplePrecedence enables grouping clauses with parens
+	SimplePrecedence
+	// SimpleFuzzy enables the fuzziness of terms like marty~1
+	SimpleFuzzy
+	// SimpleSlop enables the slop of phrases like "marty the"~2
+	SimpleSlop
+	// SimpleEscape enables escaping operators with a backslash
+	SimpleEscape
+
+	// SimpleNone disables all the operators
+	SimpleNone SimpleFlags = 0
+	// SimpleAll enables all the operators
+	SimpleAll = SimpleAnd | SimpleOr | SimpleNot | SimplePhrase | SimplePrefix |
+		SimplePrecedence | SimpleFuzzy | SimpleSlop | SimpleEscape
+)
+
+// maxSimpleFuzziness and maxSimpleSlop are the
+// largest distances of the simple syntax
+const (
+	maxSimpleFuzziness = 2
+	maxSimpleSlop      = math.MaxInt32
+)
+
+// ParseSimpleQueryString parses a query string of the simple syntax,
+// modeled on the simple_query_string of Elasticsearch, which never
+// fails.  Terms and phrases are searched in the default fields,
+// prefixed with + they are required, with - excluded, | joins
+// clauses any of which may match, parens group clauses, a trailing
+// * searches a prefix and ~N sets the fuzziness of a term or the
+// slop of a phrase.  Operators which don't fit where they are
+// written are ignored, an unclosed quote or paren is closed by
+// the end of the query string, and a query string without any
+// term matches no documents.  An invalid minimum should match
+// option is ignored.
+func ParseSimpleQueryString(query string, options QueryStringOptions) bluge.Query {
+	minShould, err := parseMinimumShouldMatch(options.minShouldMatch)
+	if err != nil {
+		minShould = nil
+	}
+	p := &simpleParser{
+		lex:   newSimpleQueryStringLex(query, options),
+		flags: options.simpleFlags,
+	}
+	p.next()
+	root := newGroup(p.parseClauses())
+
+	// values the compiler rejects, like short prefixes, are searched as text
+	options.lenient = true
+	rq, err := newCompiler(options, minShould).compileRoot(root)
+	if err != nil {
+		return bluge.NewMatchNoneQuery()
+	}
+	if options.optimize {
+		rq = optimizeQuery(rq)
+	}
+	return rq
+}
+
+// simpleParser parses the tokens of the simple syntax into a syntax
+// tree, each of its methods either reads a token or returns nil
+// at a token which ends the enclosing clauses
+type simpleParser struct {
+	lex   *queryStringLex
+	flags SimpleFlags
+	token int
+	lval  yySymType
+	// depth is the number of groups open
+	depth int
+}
+
+func (p *simpleParser) next() {
+	p.token = p.lex.Lex(&p.lval)
+}
+
+// parseClauses parses clauses up to the end of the
+// query string or the closing paren of the group
+func (p *simpleParser) parseClauses() []Node {
+	var rv []Node
+	for p.token != 0 && !(p.token == tRPAREN && p.depth > 0) {
+		if p.token == tRPAREN {
+			// a stray paren
+			p.next()
+			continue
+		}
+		if n := p.parseOr(); n != nil {
+			rv = append(rv, n)
+		}
+	}
+	return rv
+}
+
+func (p *simpleParser) parseOr() Node {
+	var clauses []Node
+	for {
+		if n := p.parseUnary(); n != nil {
+			clauses = append(clauses, n)
+		}
+		if p.token != tOR {
+			break
+		}
+		p.next()
+	}
+	if len(clauses) == 0 {
+		return nil
+	}
+	return newOr(clauses)
+}
+
+// parseUnary parses a clause with its prefix, of
+// several prefixes the last one counts
+func (p *simpleParser) parseUnary() Node {
+	start := p.lval.start
+	prefix := NoPrefix
+	for p.token == tPLUS || p.token == tMINUS {
+		prefix = MustPrefix
+		if p.token == tMINUS {
+			prefix = MustNotPrefix
+		}
+		p.next()
+	}
+	n := p.parsePrimary()
+	if n == nil {
+		return nil
+	}
+	if prefix != NoPrefix {
+		base := n.base()
+		base.Prefix = prefix
+		base.Start = start
+	}
+	return n
+}
+
+func (p *simpleParser) parsePrimary() Node {
+	start, end := p.lval.start, p.lval.end
+	switch p.token {
+	case tLPAREN:
+		p.depth++
+		p.next()
+		clauses := p.parseClauses()
+		p.depth--
+		if p.token == tRPAREN {
+			end = p.lval.end
+			p.next()
+		} else {
+			end = p.lval.start
+		}
+		if len(clauses) == 0 {
+			return nil
+		}
+		return withSpan(&Group{Clauses: clauses}, start, end)
+	case tSTRING:
+		str := p.lval.s
+		p.next()
+		n := p.term(str)
+		if p.token == tTILDE {
+			if p.flags&SimpleFuzzy != 0 {
+				n = &Fuzzy{Term: str, Fuzziness: simpleDistance(p.lval.s, maxSimpleFuzziness)}
+			}
+			end = p.lval.end
+			p.next()
+		}
+		return withSpan(n, start, end)
+	case tPHRASE:
+		phrase := p.lval.s
+		p.next()
+		n := &Phrase{Phrase: phrase}
+		if p.token == tTILDE {
+			if p.flags&SimpleSlop != 0 {
+				n.Slop = simpleDistance(p.lval.s, maxSimpleSlop)
+			}
+			end = p.lval.end
+			p.next()
+		}
+		if phrase == "" {
+			return nil
+		}
+		return withSpan(n, start, end)
+	case tTILDE:
+		// a stray tilde
+		p.next()
+	}
+	return nil
+}
+
+// term returns the node of a term, which searches
+// a prefix when it ends with the only * of the term
+func (p *simpleParser) term(str string) Node {
+	if p.flags&SimplePrefix != 0 && !strings.Contains(str, "?") {
+		if _, ok := prefixOf(str); ok {
+			return &Wildcard{Pattern: str}
+		}
+	}
+	return &Term{Term: str}
+}
+
+// simpleDistance returns the fuzziness or slop written after a
+// tilde, which is at least 0 and at most max, a distance which
+// isn't a number is 0
+func simpleDistance(str string, max int) int {
+	dist, err := strconv.ParseFloat(str, 64)
+	if err != nil || !(dist >= 0) {
+		return 0
+	} else if dist > float64(max) {
+		return max
+	}
+	return int(dist)
+}
@@ -0,0 +1,150 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystr
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/blugelabs/bluge"
+)
+
+func TestParseSimpleQueryString(t *testing.T) {
+	noFuzzyOrPrefix := DefaultOptions().WithSimpleFlags(SimpleAll &^ (SimpleFuzzy | SimplePrefix))
+
+	tests := []struct {
+		input   string
+		options QueryStringOptions
+		result  bluge.Query
+	}{
+		{
+			input:   `marty`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("marty")),
+		},
+		{
+			input:   `"fried eggs" +(eggplant | potato) -frittata`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchPhraseQuery("fried eggs")).
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewMatchQuery("eggplant")).
+						AddShould(bluge.NewMatchQuery("potato")))).
+				AddMustNot(bluge.NewMatchQuery("frittata")),
+		},
+		{
+			input:   `a+b|c`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("a")).
+				AddMust(bluge.NewBooleanQuery().
+					AddShould(bluge.NewMatchQuery("b")).
+					AddShould(bluge.NewMatchQuery("c"))),
+		},
+		{
+			input:   `mart* x~1 y~5 "p q"~3 foo-bar`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewPrefixQuery("mart")).
+				AddShould(bluge.NewMatchQuery("x").SetFuzziness(1)).
+				AddShould(bluge.NewMatchQuery("y").SetFuzziness(2)).
+				AddShould(bluge.NewMatchPhraseQuery("p q").SetSlop(3)).
+				AddShould(bluge.NewMatchQuery("foo-bar")),
+		},
+		{
+			input:   `mart* x~1 "p q"~3`,
+			options: noFuzzyOrPrefix,
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("mart*")).
+				AddShould(bluge.NewMatchQuery("x")).
+				AddShould(bluge.NewMatchPhraseQuery("p q").SetSlop(3)),
+		},
+		{
+			input:   `(a "b) +`,
+			options: DefaultOptions().WithSimpleFlags(SimpleNone),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("(a")).
+				AddShould(bluge.NewMatchQuery(`"b)`)).
+				AddShould(bluge.NewMatchQuery("+")),
+		},
+		{
+			input:   `name:marty^2 [a TO b] \+c`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("name:marty^2")).
+				AddShould(bluge.NewMatchQuery("[a")).
+				AddShould(bluge.NewMatchQuery("TO")).
+				AddShould(bluge.NewMatchQuery("b]")).
+				AddShould(bluge.NewMatchQuery("+c")),
+		},
+		{
+			input:   `((a "b c`,
+			options: DefaultOptions(),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewBooleanQuery().
+					AddShould(bluge.NewBooleanQuery().
+						AddShould(bluge.NewMatchQuery("a")).
+						AddShould(bluge.NewMatchPhraseQuery("b c")))),
+		},
+		{
+			input:   `a b`,
+			options: DefaultOptions().WithDefaultOperator(AndOperator).WithOptimize(true),
+			result: bluge.NewBooleanQuery().
+				AddMust(bluge.NewMatchQuery("a")).
+				AddMust(bluge.NewMatchQuery("b")),
+		},
+		{
+			input:   `ma*`,
+			options: DefaultOptions().WithMinPrefixLength(3),
+			result: bluge.NewBooleanQuery().
+				AddShould(bluge.NewMatchQuery("ma*")),
+		},
+		{
+			input:   `) ( | + - ~ ""`,
+			options: DefaultOptions(),
+			result:  bluge.NewMatchNoneQuery(),
+		},
+		{
+			input:   ``,
+			options: DefaultOptions(),
+			result:  bluge.NewMatchNoneQuery(),
+		},
+	}
+
+	for _, test := range tests {
+		q := ParseSimpleQueryString(test.input, test.options)
+		if !reflect.DeepEqual(q, test.result) {
+			t.Errorf("expected %#v, got %#v for %s", test.result, q, test.input)
+		}
+	}
+}
+
+func TestParseSimpleQueryStringNeverFails(t *testing.T) {
+	const runes = `ab1 +|-"*()~\:^[]{}<>=!&/@`
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		input := make([]byte, rnd.Intn(12))
+		for j := range input {
+			input[j] = runes[rnd.Intn(len(runes))]
+		}
+		options := DefaultOptions().WithSimpleFlags(SimpleFlags(rnd.Intn(int(SimpleAll) + 1)))
+		if q := ParseSimpleQueryString(string(input), options); q == nil {
+			t.Fatalf("expected a query for %s", input)
+		}
+	}
+}